@@ -17,10 +17,13 @@
 package collector
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/go-kit/log"
@@ -29,8 +32,21 @@ import (
 )
 
 type bondingCollector struct {
-	slaves, active typedDesc
-	logger         log.Logger
+	slaves, active    typedDesc
+	info              typedDesc
+	aggregatorID      typedDesc
+	slaveMIIStatus    typedDesc
+	slaveLinkFailures typedDesc
+	slaveSpeed        typedDesc
+	slaveFullDuplex   typedDesc
+	slaveAggregatorID typedDesc
+	slaveActorKey     typedDesc
+	slavePartnerKey   typedDesc
+	slavePartnerInfo  typedDesc
+	slavePortState    typedDesc
+	slaveChurned      typedDesc
+	slaveChurns       typedDesc
+	logger            log.Logger
 }
 
 func init() {
@@ -38,8 +54,15 @@ func init() {
 }
 
 // NewBondingCollector returns a newly allocated bondingCollector.
-// It exposes the number of configured and active slave of linux bonding interfaces.
+// It exposes the number of configured and active slave of linux bonding
+// interfaces, and the state of each slave.
 func NewBondingCollector(logger log.Logger) (Collector, error) {
+	slaveDesc := func(name, help string, valueType prometheus.ValueType, labels ...string) typedDesc {
+		return typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", name),
+			help, append([]string{"master", "slave"}, labels...), nil,
+		), valueType}
+	}
 	return &bondingCollector{
 		slaves: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "bonding", "slaves"),
@@ -51,7 +74,28 @@ func NewBondingCollector(logger log.Logger) (Collector, error) {
 			"Number of active slaves per bonding interface.",
 			[]string{"master"}, nil,
 		), prometheus.GaugeValue},
-		logger: logger,
+		info: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "info"),
+			"Mode and currently active slave of the bonding interface.",
+			[]string{"master", "mode", "active_slave"}, nil,
+		), prometheus.GaugeValue},
+		aggregatorID: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "ad_aggregator_id"),
+			"ID of the active 802.3ad aggregator of the bonding interface.",
+			[]string{"master"}, nil,
+		), prometheus.GaugeValue},
+		slaveMIIStatus:    slaveDesc("slave_mii_status", "Whether the MII status of the slave is up.", prometheus.GaugeValue),
+		slaveLinkFailures: slaveDesc("slave_link_failures_total", "Number of link failures of the slave.", prometheus.CounterValue),
+		slaveSpeed:        slaveDesc("slave_speed_bytes", "Speed of the slave in bytes per second.", prometheus.GaugeValue),
+		slaveFullDuplex:   slaveDesc("slave_full_duplex", "Whether the slave is in full duplex mode.", prometheus.GaugeValue),
+		slaveAggregatorID: slaveDesc("slave_ad_aggregator_id", "ID of the 802.3ad aggregator the slave belongs to.", prometheus.GaugeValue),
+		slaveActorKey:     slaveDesc("slave_ad_actor_key", "802.3ad operational key of the slave.", prometheus.GaugeValue),
+		slavePartnerKey:   slaveDesc("slave_ad_partner_key", "802.3ad operational key of the link partner of the slave.", prometheus.GaugeValue),
+		slavePartnerInfo:  slaveDesc("slave_ad_partner_info", "System MAC address of the 802.3ad link partner of the slave.", prometheus.GaugeValue, "partner_mac"),
+		slavePortState:    slaveDesc("slave_ad_port_state", "802.3ad port state bits of the actor or partner of the slave.", prometheus.GaugeValue, "side"),
+		slaveChurned:      slaveDesc("slave_ad_churned", "Whether the 802.3ad actor or partner of the slave is in the churned state.", prometheus.GaugeValue, "side"),
+		slaveChurns:       slaveDesc("slave_ad_churns_total", "Number of times the 802.3ad actor or partner of the slave entered the churned state.", prometheus.CounterValue, "side"),
+		logger:            logger,
 	}, nil
 }
 
@@ -69,6 +113,64 @@ func (c *bondingCollector) Update(ch chan<- prometheus.Metric) error {
 	for master, status := range bondingStats {
 		ch <- c.slaves.mustNewConstMetric(float64(status[0]), master)
 		ch <- c.active.mustNewConstMetric(float64(status[1]), master)
+		if err := c.updateMaster(ch, statusfile, master); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateMaster exposes the bond mode and the state of the slaves of a
+// bonding interface from /proc/net/bonding.
+func (c *bondingCollector) updateMaster(ch chan<- prometheus.Metric, root, master string) error {
+	procfile := procFilePath(filepath.Join("net/bonding", master))
+	f, err := os.Open(procfile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "Not collecting bonding slave details, file does not exist", "file", procfile)
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	status, err := parseBondingStatus(f)
+	if err != nil {
+		return fmt.Errorf("couldn't parse %s: %w", procfile, err)
+	}
+
+	// The mode in sysfs is the short name, such as "802.3ad 4".
+	mode, err := os.ReadFile(filepath.Join(root, master, "bonding", "mode"))
+	if err != nil {
+		return err
+	}
+	if fields := strings.Fields(string(mode)); len(fields) > 0 {
+		ch <- c.info.mustNewConstMetric(1, master, fields[0], status.activeSlave)
+	}
+	if status.aggregatorID != nil {
+		ch <- c.aggregatorID.mustNewConstMetric(float64(*status.aggregatorID), master)
+	}
+
+	for _, s := range status.slaves {
+		ch <- c.slaveMIIStatus.mustNewConstMetric(boolToFloat(s.miiStatus == "up"), master, s.name)
+		ch <- c.slaveLinkFailures.mustNewConstMetric(float64(s.linkFailures), master, s.name)
+		if s.speed != nil {
+			ch <- c.slaveSpeed.mustNewConstMetric(float64(*s.speed)*1000*1000/8, master, s.name)
+		}
+		if s.duplex == "full" || s.duplex == "half" {
+			ch <- c.slaveFullDuplex.mustNewConstMetric(boolToFloat(s.duplex == "full"), master, s.name)
+		}
+		if s.ad == nil {
+			continue
+		}
+		ch <- c.slaveAggregatorID.mustNewConstMetric(float64(s.ad.aggregatorID), master, s.name)
+		ch <- c.slaveActorKey.mustNewConstMetric(float64(s.ad.actor.key), master, s.name)
+		ch <- c.slavePartnerKey.mustNewConstMetric(float64(s.ad.partner.key), master, s.name)
+		ch <- c.slavePartnerInfo.mustNewConstMetric(1, master, s.name, s.ad.partner.systemMAC)
+		for side, p := range map[string]bondingLACPPort{"actor": s.ad.actor, "partner": s.ad.partner} {
+			ch <- c.slavePortState.mustNewConstMetric(float64(p.portState), master, s.name, side)
+			ch <- c.slaveChurned.mustNewConstMetric(boolToFloat(p.churnState == "churned"), master, s.name, side)
+			ch <- c.slaveChurns.mustNewConstMetric(float64(p.churns), master, s.name, side)
+		}
 	}
 	return nil
 }
@@ -103,3 +205,137 @@ func readBondingStats(root string) (status map[string][2]int, err error) {
 	}
 	return status, err
 }
+
+// bondingStatus is the state of a bonding interface in /proc/net/bonding.
+type bondingStatus struct {
+	activeSlave string
+	// ID of the active aggregator in 802.3ad mode.
+	aggregatorID *uint64
+	slaves       []*bondingSlave
+}
+
+type bondingSlave struct {
+	name         string
+	miiStatus    string
+	speed        *uint64 // Mbps, unknown while the link is down
+	duplex       string
+	linkFailures uint64
+	// 802.3ad state, only reported in 802.3ad mode.
+	ad *bondingSlaveAD
+}
+
+type bondingSlaveAD struct {
+	aggregatorID   uint64
+	actor, partner bondingLACPPort
+}
+
+// bondingLACPPort is one end of the LACP exchange of a slave.
+type bondingLACPPort struct {
+	key        uint64
+	systemMAC  string
+	portState  uint64
+	churnState string
+	churns     uint64
+}
+
+// parseBondingStatus parses a /proc/net/bonding/<master> file: a header about
+// the bonding interface followed by a section per slave, each starting with
+// "Slave Interface:".
+func parseBondingStatus(r io.Reader) (*bondingStatus, error) {
+	var (
+		status  bondingStatus
+		slave   *bondingSlave
+		lacp    *bondingLACPPort
+		scanner = bufio.NewScanner(r)
+	)
+	parseUint := func(key, value string) (uint64, error) {
+		v, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+		}
+		return v, nil
+	}
+	ad := func() *bondingSlaveAD {
+		if slave.ad == nil {
+			slave.ad = &bondingSlaveAD{}
+		}
+		return slave.ad
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		if key == "Slave Interface" {
+			slave = &bondingSlave{name: value}
+			lacp = nil
+			status.slaves = append(status.slaves, slave)
+			continue
+		}
+		if slave == nil {
+			switch key {
+			case "Currently Active Slave":
+				if value != "None" {
+					status.activeSlave = value
+				}
+			case "Aggregator ID":
+				// Of the "Active Aggregator Info".
+				id, err := parseUint(key, value)
+				if err != nil {
+					return nil, err
+				}
+				status.aggregatorID = &id
+			}
+			continue
+		}
+
+		var err error
+		switch key {
+		case "MII Status":
+			slave.miiStatus = value
+		case "Speed":
+			if speed, err := strconv.ParseUint(strings.TrimSuffix(value, " Mbps"), 10, 64); err == nil {
+				slave.speed = &speed
+			}
+		case "Duplex":
+			slave.duplex = value
+		case "Link Failure Count":
+			slave.linkFailures, err = parseUint(key, value)
+		case "Aggregator ID":
+			ad().aggregatorID, err = parseUint(key, value)
+		case "Actor Churn State":
+			ad().actor.churnState = value
+		case "Partner Churn State":
+			ad().partner.churnState = value
+		case "Actor Churned Count":
+			ad().actor.churns, err = parseUint(key, value)
+		case "Partner Churned Count":
+			ad().partner.churns, err = parseUint(key, value)
+		case "details actor lacp pdu":
+			lacp = &ad().actor
+		case "details partner lacp pdu":
+			lacp = &ad().partner
+		case "port key", "oper key":
+			if lacp != nil {
+				lacp.key, err = parseUint(key, value)
+			}
+		case "system mac address":
+			if lacp != nil {
+				lacp.systemMAC = value
+			}
+		case "port state":
+			if lacp != nil {
+				lacp.portState, err = parseUint(key, value)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &status, scanner.Err()
+}
@@ -17,6 +17,7 @@
 package collector
 
 import (
+	"os"
 	"testing"
 )
 
@@ -37,3 +38,54 @@ func TestBonding(t *testing.T) {
 		t.Fatal("dmz in unexpected state")
 	}
 }
+
+func TestBondingStatus(t *testing.T) {
+	f, err := os.Open("fixtures/proc/net/bonding/dmz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	status, err := parseBondingStatus(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.activeSlave != "" {
+		t.Errorf("unexpected active slave %q", status.activeSlave)
+	}
+	if status.aggregatorID == nil || *status.aggregatorID != 1 {
+		t.Fatalf("unexpected active aggregator %v", status.aggregatorID)
+	}
+	if len(status.slaves) != 2 {
+		t.Fatalf("want 2 slaves, got %d", len(status.slaves))
+	}
+	eth4 := status.slaves[1]
+	if eth4.name != "eth4" || eth4.miiStatus != "up" || eth4.duplex != "full" || eth4.speed == nil || *eth4.speed != 10000 {
+		t.Errorf("unexpected slave %+v", eth4)
+	}
+	want := bondingSlaveAD{
+		aggregatorID: 2,
+		actor:        bondingLACPPort{key: 15, systemMAC: "52:54:00:12:34:56", portState: 69, churnState: "churned", churns: 1},
+		partner:      bondingLACPPort{key: 1, systemMAC: "00:00:00:00:00:00", portState: 1, churnState: "churned", churns: 1},
+	}
+	if eth4.ad == nil || *eth4.ad != want {
+		t.Errorf("want 802.3ad state %+v, got %+v", want, eth4.ad)
+	}
+
+	f, err = os.Open("fixtures/proc/net/bonding/int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	status, err = parseBondingStatus(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.activeSlave != "eth5" || status.aggregatorID != nil {
+		t.Errorf("unexpected status %+v", status)
+	}
+	eth1 := status.slaves[1]
+	if eth1.name != "eth1" || eth1.speed != nil || eth1.linkFailures != 3 || eth1.ad != nil {
+		t.Errorf("unexpected slave %+v", eth1)
+	}
+}
@@ -0,0 +1,602 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nobridge
+// +build !nobridge
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/josharian/native"
+	"github.com/jsimonetti/rtnetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// IFLA_BRIDGE_VLAN_INFO and struct bridge_vlan_info flags of
+	// include/uapi/linux/if_bridge.h.
+	iflaBridgeVLANInfo       = 2
+	bridgeVLANInfoPVID       = 1 << 1
+	bridgeVLANInfoUntagged   = 1 << 2
+	bridgeVLANInfoRangeBegin = 1 << 3
+	bridgeVLANInfoRangeEnd   = 1 << 4
+	sizeOfBridgeVLANInfo     = 4
+
+	// RTEXT_FILTER_BRVLAN of include/uapi/linux/rtnetlink.h.
+	rtextFilterBridgeVLAN = 1 << 1
+	sizeOfIfInfomsg       = 16
+
+	// RTM_GETSTATS attributes of include/uapi/linux/if_link.h and
+	// include/uapi/linux/if_bridge.h.
+	linkXstatsTypeBridge = 1
+	bridgeXstatsMcast    = 2
+	sizeOfIfStatsMsg     = 12
+	// struct br_mcast_stats, 30 counters of 64 bits.
+	sizeOfBridgeMcastStats = 30 * 8
+)
+
+var (
+	bridgeDeviceInclude = kingpin.Flag("collector.bridge.device-include", "Regexp of bridges to include (mutually exclusive to device-exclude).").String()
+	bridgeDeviceExclude = kingpin.Flag("collector.bridge.device-exclude", "Regexp of bridges to exclude (mutually exclusive to device-include).").String()
+	bridgeVLANs         = kingpin.Flag("collector.bridge.vlans", "Enables a series for each VLAN each bridge port is a member of.").Bool()
+
+	// Counters of struct br_mcast_stats in include/uapi/linux/if_bridge.h,
+	// in order. Most are pairs of received and transmitted counts.
+	bridgeMcastCounters = []struct {
+		name, version string
+		directions    bool
+	}{
+		{"igmp_queries_total", "1", true},
+		{"igmp_queries_total", "2", true},
+		{"igmp_queries_total", "3", true},
+		{"igmp_leaves_total", "", true},
+		{"igmp_reports_total", "1", true},
+		{"igmp_reports_total", "2", true},
+		{"igmp_reports_total", "3", true},
+		{"igmp_parse_errors_total", "", false},
+		{"mld_queries_total", "1", true},
+		{"mld_queries_total", "2", true},
+		{"mld_leaves_total", "", true},
+		{"mld_reports_total", "1", true},
+		{"mld_reports_total", "2", true},
+		{"mld_parse_errors_total", "", false},
+		{"bytes_total", "", true},
+		{"packets_total", "", true},
+	}
+
+	// STP port states, BR_STATE_* in include/uapi/linux/if_bridge.h.
+	bridgePortStates = []string{"disabled", "listening", "learning", "forwarding", "blocking"}
+
+	// Multicast snooping settings in /sys/class/net/<bridge>/bridge.
+	bridgeMulticastFiles = []struct {
+		file, name, help string
+	}{
+		{"multicast_snooping", "multicast_snooping", "Whether IGMP/MLD snooping is enabled on the bridge."},
+		{"multicast_stats_enabled", "multicast_stats_enabled", "Whether the bridge counts IGMP/MLD snooping statistics."},
+		{"multicast_querier", "multicast_querier", "Whether the bridge acts as IGMP/MLD querier."},
+		{"multicast_router", "multicast_router", "Multicast router mode of the bridge: 0 disabled, 1 automatic, 2 permanent."},
+		{"hash_max", "multicast_hash_max", "Maximum number of multicast groups in the snooping table of the bridge."},
+		{"multicast_last_member_count", "multicast_last_member_count", "Number of queries sent after a leave message before the group is removed."},
+		{"multicast_startup_query_count", "multicast_startup_query_count", "Number of queries sent on startup of the querier."},
+	}
+)
+
+type bridgeCollector struct {
+	deviceFilter deviceFilter
+	vlans        bool
+
+	stpState       typedDesc
+	vlanFiltering  typedDesc
+	topologyChange typedDesc
+	rootPort       typedDesc
+	multicast      []typedDesc
+	mcastCounters  map[string]typedDesc
+
+	portState      typedDesc
+	portPathCost   typedDesc
+	portPriority   typedDesc
+	portFDBEntries typedDesc
+	portVLANs      typedDesc
+	portPVID       typedDesc
+	portVLANInfo   typedDesc
+
+	logger log.Logger
+}
+
+func init() {
+	registerCollector("bridge", defaultDisabled, NewBridgeCollector)
+}
+
+// NewBridgeCollector returns a new Collector exposing Linux bridge and bridge
+// port statistics.
+func NewBridgeCollector(logger log.Logger) (Collector, error) {
+	desc := func(name, help string, labels ...string) typedDesc {
+		return typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bridge", name),
+			help, labels, nil,
+		), prometheus.GaugeValue}
+	}
+	c := &bridgeCollector{
+		deviceFilter: newDeviceFilter(*bridgeDeviceExclude, *bridgeDeviceInclude),
+		vlans:        *bridgeVLANs,
+
+		stpState:       desc("stp_state", "STP mode of the bridge: 0 disabled, 1 kernel STP, 2 user space STP.", "bridge"),
+		vlanFiltering:  desc("vlan_filtering", "Whether VLAN filtering is enabled on the bridge.", "bridge"),
+		topologyChange: desc("topology_change", "Whether the bridge is in an STP topology change.", "bridge"),
+		rootPort:       desc("root_port", "STP port number of the root port of the bridge, 0 if it is the root bridge.", "bridge"),
+
+		portState:      desc("port_state", "STP state of the bridge port.", "bridge", "port", "state"),
+		portPathCost:   desc("port_path_cost", "STP path cost of the bridge port.", "bridge", "port"),
+		portPriority:   desc("port_priority", "STP priority of the bridge port.", "bridge", "port"),
+		portFDBEntries: desc("port_fdb_entries", "Number of forwarding database entries of the bridge port.", "bridge", "port", "type"),
+		portVLANs:      desc("port_vlans", "Number of VLANs the bridge port is a member of.", "bridge", "port"),
+		portPVID:       desc("port_pvid", "VLAN of untagged frames received on the bridge port.", "bridge", "port"),
+		portVLANInfo:   desc("port_vlan_info", "VLAN the bridge port is a member of.", "bridge", "port", "vlan", "untagged"),
+
+		logger: logger,
+	}
+	for _, f := range bridgeMulticastFiles {
+		c.multicast = append(c.multicast, desc(f.name, f.help, "bridge"))
+	}
+	counter := func(name, help string, labels ...string) typedDesc {
+		d := desc(name, help, labels...)
+		d.valueType = prometheus.CounterValue
+		return d
+	}
+	c.mcastCounters = map[string]typedDesc{
+		"igmp_queries_total":      counter("multicast_igmp_queries_total", "IGMP queries snooped by the bridge.", "bridge", "direction", "version"),
+		"igmp_leaves_total":       counter("multicast_igmp_leaves_total", "IGMP leave messages snooped by the bridge.", "bridge", "direction"),
+		"igmp_reports_total":      counter("multicast_igmp_reports_total", "IGMP membership reports snooped by the bridge.", "bridge", "direction", "version"),
+		"igmp_parse_errors_total": counter("multicast_igmp_parse_errors_total", "Invalid IGMP packets received by the bridge.", "bridge"),
+		"mld_queries_total":       counter("multicast_mld_queries_total", "MLD queries snooped by the bridge.", "bridge", "direction", "version"),
+		"mld_leaves_total":        counter("multicast_mld_leaves_total", "MLD done messages snooped by the bridge.", "bridge", "direction"),
+		"mld_reports_total":       counter("multicast_mld_reports_total", "MLD listener reports snooped by the bridge.", "bridge", "direction", "version"),
+		"mld_parse_errors_total":  counter("multicast_mld_parse_errors_total", "Invalid MLD packets received by the bridge.", "bridge"),
+		"bytes_total":             counter("multicast_bytes_total", "Multicast bytes forwarded by the bridge.", "bridge", "direction"),
+		"packets_total":           counter("multicast_packets_total", "Multicast packets forwarded by the bridge.", "bridge", "direction"),
+	}
+	return c, nil
+}
+
+// bridge is a Linux bridge.
+type bridge struct {
+	name           string
+	stpState       uint32
+	vlanFiltering  uint8
+	topologyChange uint8
+	rootPort       uint16
+}
+
+// bridgePort is an interface attached to a bridge.
+type bridgePort struct {
+	name     string
+	master   uint32
+	state    uint8
+	pathCost uint32
+	priority uint16
+}
+
+// bridgeVLAN is a VLAN a bridge port is a member of.
+type bridgeVLAN struct {
+	vid      uint16
+	pvid     bool
+	untagged bool
+}
+
+func (c *bridgeCollector) Update(ch chan<- prometheus.Metric) error {
+	conn, err := rtnetlink.Dial(nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	links, err := conn.Link.List()
+	if err != nil {
+		return fmt.Errorf("couldn't list links: %w", err)
+	}
+	bridges, ports, err := parseBridgeLinks(links)
+	if err != nil {
+		return err
+	}
+	for index, br := range bridges {
+		if c.deviceFilter.ignored(br.name) {
+			delete(bridges, index)
+		}
+	}
+	if len(bridges) == 0 {
+		return ErrNoData
+	}
+
+	for _, br := range bridges {
+		ch <- c.stpState.mustNewConstMetric(float64(br.stpState), br.name)
+		ch <- c.vlanFiltering.mustNewConstMetric(float64(br.vlanFiltering), br.name)
+		ch <- c.topologyChange.mustNewConstMetric(float64(br.topologyChange), br.name)
+		ch <- c.rootPort.mustNewConstMetric(float64(br.rootPort), br.name)
+		if err := c.updateMulticast(ch, br.name); err != nil {
+			return err
+		}
+	}
+
+	mcastStats, err := getBridgeMcastStats()
+	if err != nil {
+		// RTM_GETSTATS needs Linux 4.7, the bridge statistics 4.8.
+		level.Debug(c.logger).Log("msg", "Not collecting bridge multicast statistics", "err", err)
+	}
+	for index, br := range bridges {
+		if stats, ok := mcastStats[index]; ok {
+			c.updateMcastStats(ch, br.name, stats)
+		}
+	}
+
+	for _, port := range ports {
+		br, ok := bridges[port.master]
+		if !ok {
+			continue
+		}
+		for i, state := range bridgePortStates {
+			ch <- c.portState.mustNewConstMetric(boolToFloat(int(port.state) == i), br.name, port.name, state)
+		}
+		ch <- c.portPathCost.mustNewConstMetric(float64(port.pathCost), br.name, port.name)
+		ch <- c.portPriority.mustNewConstMetric(float64(port.priority), br.name, port.name)
+	}
+
+	neighs, err := conn.Execute(&rtnetlink.NeighMessage{Family: unix.AF_BRIDGE}, unix.RTM_GETNEIGH, netlink.Request|netlink.Dump)
+	if err != nil {
+		return fmt.Errorf("couldn't get bridge forwarding database: %w", err)
+	}
+	fdb := countBridgeFDBEntries(neighs)
+	for index, port := range ports {
+		br, ok := bridges[port.master]
+		if !ok {
+			continue
+		}
+		for _, typ := range []string{"dynamic", "local", "static"} {
+			ch <- c.portFDBEntries.mustNewConstMetric(fdb[index][typ], br.name, port.name, typ)
+		}
+	}
+
+	vlans, err := getBridgeVLANs()
+	if err != nil {
+		return fmt.Errorf("couldn't get bridge VLANs: %w", err)
+	}
+	for index, port := range ports {
+		br, ok := bridges[port.master]
+		if !ok || br.vlanFiltering == 0 {
+			continue
+		}
+		ch <- c.portVLANs.mustNewConstMetric(float64(len(vlans[index])), br.name, port.name)
+		for _, vlan := range vlans[index] {
+			if vlan.pvid {
+				ch <- c.portPVID.mustNewConstMetric(float64(vlan.vid), br.name, port.name)
+			}
+			if c.vlans {
+				ch <- c.portVLANInfo.mustNewConstMetric(1, br.name, port.name, strconv.Itoa(int(vlan.vid)), strconv.FormatBool(vlan.untagged))
+			}
+		}
+	}
+
+	return nil
+}
+
+// updateMulticast exposes the multicast snooping settings of a bridge from
+// sysfs.
+func (c *bridgeCollector) updateMulticast(ch chan<- prometheus.Metric, name string) error {
+	for i, f := range bridgeMulticastFiles {
+		path := sysFilePath(filepath.Join("class/net", name, "bridge", f.file))
+		value, err := readUintFromFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// Not built with CONFIG_BRIDGE_IGMP_SNOOPING.
+				level.Debug(c.logger).Log("msg", "Not collecting bridge multicast setting, file does not exist", "file", path)
+				continue
+			}
+			return fmt.Errorf("couldn't read %s: %w", path, err)
+		}
+		ch <- c.multicast[i].mustNewConstMetric(float64(value), name)
+	}
+	return nil
+}
+
+// updateMcastStats exposes the IGMP/MLD snooping counters of a bridge. The
+// kernel only counts while multicast_stats_enabled is set.
+func (c *bridgeCollector) updateMcastStats(ch chan<- prometheus.Metric, name string, stats []uint64) {
+	i := 0
+	for _, counter := range bridgeMcastCounters {
+		d := c.mcastCounters[counter.name]
+		directions := []string{"rx", "tx"}
+		if !counter.directions {
+			directions = []string{""}
+		}
+		for _, direction := range directions {
+			labels := []string{name}
+			if direction != "" {
+				labels = append(labels, direction)
+			}
+			if counter.version != "" {
+				labels = append(labels, counter.version)
+			}
+			ch <- d.mustNewConstMetric(float64(stats[i]), labels...)
+			i++
+		}
+	}
+}
+
+// parseBridgeLinks returns the bridges and bridge ports among the links, by
+// interface index.
+func parseBridgeLinks(links []rtnetlink.LinkMessage) (map[uint32]*bridge, map[uint32]*bridgePort, error) {
+	bridges := map[uint32]*bridge{}
+	ports := map[uint32]*bridgePort{}
+
+	for _, link := range links {
+		attrs := link.Attributes
+		if attrs == nil || attrs.Info == nil {
+			continue
+		}
+		if attrs.Info.Kind == "bridge" {
+			br := &bridge{name: attrs.Name}
+			if err := decodeBridgeAttributes(attrs.Info.Data, func(ad *netlink.AttributeDecoder) {
+				switch ad.Type() {
+				case unix.IFLA_BR_STP_STATE:
+					br.stpState = ad.Uint32()
+				case unix.IFLA_BR_VLAN_FILTERING:
+					br.vlanFiltering = ad.Uint8()
+				case unix.IFLA_BR_TOPOLOGY_CHANGE:
+					br.topologyChange = ad.Uint8()
+				case unix.IFLA_BR_ROOT_PORT:
+					br.rootPort = ad.Uint16()
+				}
+			}); err != nil {
+				return nil, nil, fmt.Errorf("invalid attributes of bridge %s: %w", attrs.Name, err)
+			}
+			bridges[link.Index] = br
+		}
+		if attrs.Info.SlaveKind == "bridge" && attrs.Master != nil {
+			port := &bridgePort{name: attrs.Name, master: *attrs.Master}
+			if err := decodeBridgeAttributes(attrs.Info.SlaveData, func(ad *netlink.AttributeDecoder) {
+				switch ad.Type() {
+				case unix.IFLA_BRPORT_STATE:
+					port.state = ad.Uint8()
+				case unix.IFLA_BRPORT_COST:
+					port.pathCost = ad.Uint32()
+				case unix.IFLA_BRPORT_PRIORITY:
+					port.priority = ad.Uint16()
+				}
+			}); err != nil {
+				return nil, nil, fmt.Errorf("invalid attributes of bridge port %s: %w", attrs.Name, err)
+			}
+			ports[link.Index] = port
+		}
+	}
+
+	return bridges, ports, nil
+}
+
+func decodeBridgeAttributes(b []byte, decode func(ad *netlink.AttributeDecoder)) error {
+	if len(b) == 0 {
+		return nil
+	}
+	ad, err := netlink.NewAttributeDecoder(b)
+	if err != nil {
+		return err
+	}
+	for ad.Next() {
+		decode(ad)
+	}
+	return ad.Err()
+}
+
+// countBridgeFDBEntries counts the forwarding database entries learned or
+// configured on each bridge port, by interface index and type. Entries of
+// the ports' own address lists, flagged NTF_SELF, are not bridge entries.
+func countBridgeFDBEntries(msgs []rtnetlink.Message) map[uint32]map[string]float64 {
+	entries := map[uint32]map[string]float64{}
+
+	for _, m := range msgs {
+		n, ok := m.(*rtnetlink.NeighMessage)
+		if !ok || n.Flags&unix.NTF_SELF != 0 {
+			continue
+		}
+		// The bridge shows permanent entries, the addresses of its ports, as
+		// local.
+		typ := "dynamic"
+		switch {
+		case n.State&unix.NUD_PERMANENT != 0:
+			typ = "local"
+		case n.State&unix.NUD_NOARP != 0:
+			typ = "static"
+		}
+		if entries[n.Index] == nil {
+			entries[n.Index] = map[string]float64{}
+		}
+		entries[n.Index][typ]++
+	}
+
+	return entries
+}
+
+// getBridgeVLANs returns the VLANs of each bridge port by interface index.
+// rtnetlink.LinkService can't request them, as they are only dumped for the
+// AF_BRIDGE family with RTEXT_FILTER_BRVLAN set in IFLA_EXT_MASK.
+func getBridgeVLANs() (map[uint32][]bridgeVLAN, error) {
+	conn, err := netlink.Dial(unix.NETLINK_ROUTE, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ae := netlink.NewAttributeEncoder()
+	ae.Uint32(unix.IFLA_EXT_MASK, rtextFilterBridgeVLAN)
+	attrs, err := ae.Encode()
+	if err != nil {
+		return nil, err
+	}
+	// struct ifinfomsg with only the family set.
+	data := make([]byte, sizeOfIfInfomsg, sizeOfIfInfomsg+len(attrs))
+	data[0] = unix.AF_BRIDGE
+	msgs, err := conn.Execute(netlink.Message{
+		Header: netlink.Header{
+			Type:  unix.RTM_GETLINK,
+			Flags: netlink.Request | netlink.Dump,
+		},
+		Data: append(data, attrs...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseBridgeVLANs(msgs)
+}
+
+// parseBridgeVLANs parses the IFLA_BRIDGE_VLAN_INFO attributes of AF_BRIDGE
+// link messages.
+func parseBridgeVLANs(msgs []netlink.Message) (map[uint32][]bridgeVLAN, error) {
+	vlans := map[uint32][]bridgeVLAN{}
+
+	for _, m := range msgs {
+		if len(m.Data) < sizeOfIfInfomsg {
+			return nil, fmt.Errorf("short ifinfomsg of %d bytes", len(m.Data))
+		}
+		index := native.Endian.Uint32(m.Data[4:8])
+		ad, err := netlink.NewAttributeDecoder(m.Data[sizeOfIfInfomsg:])
+		if err != nil {
+			return nil, err
+		}
+		for ad.Next() {
+			if ad.Type() != unix.IFLA_AF_SPEC {
+				continue
+			}
+			ad.Nested(func(nad *netlink.AttributeDecoder) error {
+				var rangeStart *bridgeVLAN
+				for nad.Next() {
+					b := nad.Bytes()
+					if nad.Type() != iflaBridgeVLANInfo || len(b) < sizeOfBridgeVLANInfo {
+						continue
+					}
+					flags := native.Endian.Uint16(b)
+					vlan := bridgeVLAN{
+						vid:      native.Endian.Uint16(b[2:]),
+						pvid:     flags&bridgeVLANInfoPVID != 0,
+						untagged: flags&bridgeVLANInfoUntagged != 0,
+					}
+					switch {
+					case flags&bridgeVLANInfoRangeBegin != 0:
+						rangeStart = &vlan
+					case flags&bridgeVLANInfoRangeEnd != 0 && rangeStart != nil:
+						for vid := rangeStart.vid; vid < vlan.vid; vid++ {
+							vlans[index] = append(vlans[index], bridgeVLAN{vid: vid, untagged: rangeStart.untagged})
+						}
+						vlans[index] = append(vlans[index], vlan)
+						rangeStart = nil
+					default:
+						vlans[index] = append(vlans[index], vlan)
+					}
+				}
+				return nad.Err()
+			})
+		}
+		if err := ad.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, v := range vlans {
+		sort.Slice(v, func(i, j int) bool { return v[i].vid < v[j].vid })
+	}
+	return vlans, nil
+}
+
+// getBridgeMcastStats returns the counters of struct br_mcast_stats of each
+// bridge by interface index, from the bridge extended link statistics.
+func getBridgeMcastStats() (map[uint32][]uint64, error) {
+	conn, err := netlink.Dial(unix.NETLINK_ROUTE, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// struct if_stats_msg of all links, with only the extended link
+	// statistics in the filter mask.
+	data := make([]byte, sizeOfIfStatsMsg)
+	native.Endian.PutUint32(data[8:], 1<<(unix.IFLA_STATS_LINK_XSTATS-1))
+	msgs, err := conn.Execute(netlink.Message{
+		Header: netlink.Header{
+			Type:  unix.RTM_GETSTATS,
+			Flags: netlink.Request | netlink.Dump,
+		},
+		Data: data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseBridgeMcastStats(msgs)
+}
+
+// parseBridgeMcastStats parses the BRIDGE_XSTATS_MCAST attributes of
+// RTM_NEWSTATS messages. Only bridges have them.
+func parseBridgeMcastStats(msgs []netlink.Message) (map[uint32][]uint64, error) {
+	stats := map[uint32][]uint64{}
+
+	for _, m := range msgs {
+		if len(m.Data) < sizeOfIfStatsMsg {
+			return nil, fmt.Errorf("short if_stats_msg of %d bytes", len(m.Data))
+		}
+		index := native.Endian.Uint32(m.Data[4:8])
+		ad, err := netlink.NewAttributeDecoder(m.Data[sizeOfIfStatsMsg:])
+		if err != nil {
+			return nil, err
+		}
+		for ad.Next() {
+			if ad.Type() != unix.IFLA_STATS_LINK_XSTATS {
+				continue
+			}
+			ad.Nested(func(xad *netlink.AttributeDecoder) error {
+				for xad.Next() {
+					if xad.Type() != linkXstatsTypeBridge {
+						continue
+					}
+					xad.Nested(func(bad *netlink.AttributeDecoder) error {
+						for bad.Next() {
+							b := bad.Bytes()
+							if bad.Type() != bridgeXstatsMcast || len(b) < sizeOfBridgeMcastStats {
+								continue
+							}
+							counters := make([]uint64, sizeOfBridgeMcastStats/8)
+							for i := range counters {
+								counters[i] = native.Endian.Uint64(b[i*8:])
+							}
+							stats[index] = counters
+						}
+						return bad.Err()
+					})
+				}
+				return xad.Err()
+			})
+		}
+		if err := ad.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
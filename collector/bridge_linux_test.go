@@ -0,0 +1,177 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nobridge
+// +build !nobridge
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/josharian/native"
+	"github.com/jsimonetti/rtnetlink"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func encodeBridgeAttributes(t *testing.T, encode func(ae *netlink.AttributeEncoder)) []byte {
+	ae := netlink.NewAttributeEncoder()
+	encode(ae)
+	b, err := ae.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseBridgeLinks(t *testing.T) {
+	master := uint32(3)
+	links := []rtnetlink.LinkMessage{
+		{Index: 1, Attributes: &rtnetlink.LinkAttributes{Name: "lo"}},
+		{Index: 3, Attributes: &rtnetlink.LinkAttributes{
+			Name: "br0",
+			Info: &rtnetlink.LinkInfo{
+				Kind: "bridge",
+				Data: encodeBridgeAttributes(t, func(ae *netlink.AttributeEncoder) {
+					ae.Uint32(unix.IFLA_BR_STP_STATE, 1)
+					ae.Uint8(unix.IFLA_BR_VLAN_FILTERING, 1)
+					ae.Uint8(unix.IFLA_BR_TOPOLOGY_CHANGE, 0)
+					ae.Uint16(unix.IFLA_BR_ROOT_PORT, 2)
+				}),
+			},
+		}},
+		{Index: 4, Attributes: &rtnetlink.LinkAttributes{
+			Name:   "eth0",
+			Master: &master,
+			Info: &rtnetlink.LinkInfo{
+				SlaveKind: "bridge",
+				SlaveData: encodeBridgeAttributes(t, func(ae *netlink.AttributeEncoder) {
+					ae.Uint8(unix.IFLA_BRPORT_STATE, 3)
+					ae.Uint16(unix.IFLA_BRPORT_PRIORITY, 32)
+					ae.Uint32(unix.IFLA_BRPORT_COST, 100)
+				}),
+			},
+		}},
+		// A bonding slave is not a bridge port.
+		{Index: 5, Attributes: &rtnetlink.LinkAttributes{
+			Name:   "eth1",
+			Master: &master,
+			Info:   &rtnetlink.LinkInfo{SlaveKind: "bond"},
+		}},
+	}
+
+	bridges, ports, err := parseBridgeLinks(links)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantBridges := map[uint32]*bridge{
+		3: {name: "br0", stpState: 1, vlanFiltering: 1, rootPort: 2},
+	}
+	if !reflect.DeepEqual(wantBridges, bridges) {
+		t.Errorf("want bridges %+v, got %+v", wantBridges[3], bridges[3])
+	}
+	wantPorts := map[uint32]*bridgePort{
+		4: {name: "eth0", master: 3, state: 3, pathCost: 100, priority: 32},
+	}
+	if !reflect.DeepEqual(wantPorts, ports) {
+		t.Errorf("want ports %+v, got %+v", wantPorts, ports)
+	}
+}
+
+func TestCountBridgeFDBEntries(t *testing.T) {
+	msgs := []rtnetlink.Message{
+		&rtnetlink.NeighMessage{Family: unix.AF_BRIDGE, Index: 4, State: unix.NUD_REACHABLE},
+		&rtnetlink.NeighMessage{Family: unix.AF_BRIDGE, Index: 4, State: unix.NUD_STALE},
+		&rtnetlink.NeighMessage{Family: unix.AF_BRIDGE, Index: 4, State: unix.NUD_PERMANENT},
+		&rtnetlink.NeighMessage{Family: unix.AF_BRIDGE, Index: 4, State: unix.NUD_NOARP},
+		// The multicast address list of the port itself.
+		&rtnetlink.NeighMessage{Family: unix.AF_BRIDGE, Index: 4, State: unix.NUD_PERMANENT, Flags: unix.NTF_SELF},
+	}
+
+	want := map[uint32]map[string]float64{4: {"dynamic": 2, "local": 1, "static": 1}}
+	if got := countBridgeFDBEntries(msgs); !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestParseBridgeVLANs(t *testing.T) {
+	vlanInfo := func(flags, vid uint16) []byte {
+		b := make([]byte, sizeOfBridgeVLANInfo)
+		native.Endian.PutUint16(b, flags)
+		native.Endian.PutUint16(b[2:], vid)
+		return b
+	}
+	data := make([]byte, sizeOfIfInfomsg)
+	data[0] = unix.AF_BRIDGE
+	native.Endian.PutUint32(data[4:], 4)
+	data = append(data, encodeBridgeAttributes(t, func(ae *netlink.AttributeEncoder) {
+		ae.String(unix.IFLA_IFNAME, "eth0")
+		ae.Nested(unix.IFLA_AF_SPEC, func(nae *netlink.AttributeEncoder) error {
+			nae.Bytes(iflaBridgeVLANInfo, vlanInfo(bridgeVLANInfoPVID|bridgeVLANInfoUntagged, 20))
+			nae.Bytes(iflaBridgeVLANInfo, vlanInfo(bridgeVLANInfoRangeBegin, 10))
+			nae.Bytes(iflaBridgeVLANInfo, vlanInfo(bridgeVLANInfoRangeEnd, 12))
+			return nil
+		})
+	})...)
+
+	vlans, err := parseBridgeVLANs([]netlink.Message{{Data: data}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint32][]bridgeVLAN{4: {
+		{vid: 10},
+		{vid: 11},
+		{vid: 12},
+		{vid: 20, pvid: true, untagged: true},
+	}}
+	if !reflect.DeepEqual(want, vlans) {
+		t.Errorf("want %+v, got %+v", want, vlans)
+	}
+}
+
+func TestParseBridgeMcastStats(t *testing.T) {
+	mcast := make([]byte, sizeOfBridgeMcastStats)
+	want := make([]uint64, sizeOfBridgeMcastStats/8)
+	for i := range want {
+		want[i] = uint64(i + 1)
+		native.Endian.PutUint64(mcast[i*8:], want[i])
+	}
+	message := func(index uint32, encode func(ae *netlink.AttributeEncoder)) netlink.Message {
+		data := make([]byte, sizeOfIfStatsMsg)
+		native.Endian.PutUint32(data[4:], index)
+		return netlink.Message{Data: append(data, encodeBridgeAttributes(t, encode)...)}
+	}
+	msgs := []netlink.Message{
+		// A link without extended statistics.
+		message(1, func(ae *netlink.AttributeEncoder) {}),
+		message(3, func(ae *netlink.AttributeEncoder) {
+			ae.Nested(unix.IFLA_STATS_LINK_XSTATS, func(xae *netlink.AttributeEncoder) error {
+				xae.Nested(linkXstatsTypeBridge, func(bae *netlink.AttributeEncoder) error {
+					bae.Bytes(bridgeXstatsMcast, mcast)
+					return nil
+				})
+				return nil
+			})
+		}),
+	}
+
+	stats, err := parseBridgeMcastStats(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(map[uint32][]uint64{3: want}, stats) {
+		t.Errorf("want %v, got %v", want, stats)
+	}
+}
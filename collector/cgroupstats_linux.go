@@ -0,0 +1,494 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nocgroupstats
+// +build !nocgroupstats
+
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const cgroupStatsSubsystem = "cgroup"
+
+var (
+	cgroupStatsInclude  = kingpin.Flag("collector.cgroupstats.include", "Regexp of cgroup paths to include, e.g. ^/system.slice/.").Default("").String()
+	cgroupStatsExclude  = kingpin.Flag("collector.cgroupstats.exclude", "Regexp of cgroup paths to exclude.").Default("").String()
+	cgroupStatsPressure = kingpin.Flag("collector.cgroupstats.pressure", "Expose pressure stall information of each cgroup.").Bool()
+	cgroupStatsMaxDepth = kingpin.Flag("collector.cgroupstats.max-depth", "Maximum depth below the root cgroup to report, 0 for only the root cgroup.").Default("2").Int()
+)
+
+// cgroupStatsKey maps a key of a flat keyed cgroup file to a metric, dividing
+// the value by divisor.
+type cgroupStatsKey struct {
+	desc    typedDesc
+	divisor float64
+}
+
+type cgroupStatsCollector struct {
+	filter   deviceFilter
+	maxDepth int
+
+	cpuStat      map[string]cgroupStatsKey
+	memoryUsage  typedDesc
+	memoryMax    typedDesc
+	memoryHigh   typedDesc
+	memoryEvents typedDesc
+	ioStat       map[string]typedDesc
+	pids         typedDesc
+	pidsMax      typedDesc
+	// cgroup v1 only.
+	cpuacctStat    map[string]cgroupStatsKey
+	cpuStatV1      map[string]cgroupStatsKey
+	memoryFailures typedDesc
+	memoryStat     typedDesc
+	memoryFaults   map[string]typedDesc
+	// Pressure stall descriptors by resource and "some" or "full", nil
+	// unless enabled.
+	pressure map[string]map[string]typedDesc
+	logger   log.Logger
+}
+
+func init() {
+	registerCollector("cgroupstats", defaultDisabled, NewCgroupStatsCollector)
+}
+
+// NewCgroupStatsCollector returns a new Collector exposing per-cgroup resource
+// usage from the cgroup v2 unified hierarchy and cgroup v1 controllers.
+func NewCgroupStatsCollector(logger log.Logger) (Collector, error) {
+	if *cgroupStatsMaxDepth < 0 {
+		return nil, fmt.Errorf("invalid cgroup max depth %d", *cgroupStatsMaxDepth)
+	}
+
+	cgroupDesc := func(name, help string, valueType prometheus.ValueType, labels ...string) typedDesc {
+		return typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, cgroupStatsSubsystem, name),
+			help, append([]string{"cgroup"}, labels...), nil,
+		), valueType}
+	}
+	ioDesc := func(name, help string) typedDesc {
+		return cgroupDesc(name, help, prometheus.CounterValue, "device")
+	}
+
+	var pressure map[string]map[string]typedDesc
+	if *cgroupStatsPressure {
+		pressureDesc := func(name, help string) typedDesc {
+			return cgroupDesc("pressure_"+name, help, prometheus.CounterValue)
+		}
+		pressure = map[string]map[string]typedDesc{
+			"cpu": {
+				"some": pressureDesc("cpu_waiting_seconds_total", "Total time in seconds that processes of the cgroup have waited for CPU time."),
+				"full": pressureDesc("cpu_stalled_seconds_total", "Total time in seconds no process of the cgroup could make progress due to CPU congestion."),
+			},
+			"io": {
+				"some": pressureDesc("io_waiting_seconds_total", "Total time in seconds that processes of the cgroup have waited due to IO congestion."),
+				"full": pressureDesc("io_stalled_seconds_total", "Total time in seconds no process of the cgroup could make progress due to IO congestion."),
+			},
+			"memory": {
+				"some": pressureDesc("memory_waiting_seconds_total", "Total time in seconds that processes of the cgroup have waited for memory."),
+				"full": pressureDesc("memory_stalled_seconds_total", "Total time in seconds no process of the cgroup could make progress due to memory congestion."),
+			},
+			"irq": {
+				"full": pressureDesc("irq_stalled_seconds_total", "Total time in seconds no process of the cgroup could make progress due to IRQ/SoftIRQ processing."),
+			},
+		}
+	}
+
+	c := &cgroupStatsCollector{
+		filter:   newDeviceFilter(*cgroupStatsExclude, *cgroupStatsInclude),
+		maxDepth: *cgroupStatsMaxDepth,
+		cpuStat: map[string]cgroupStatsKey{
+			"usage_usec":     {cgroupDesc("cpu_usage_seconds_total", "Total CPU time consumed by the cgroup.", prometheus.CounterValue), 1e6},
+			"user_usec":      {cgroupDesc("cpu_user_seconds_total", "CPU time consumed by the cgroup in user mode.", prometheus.CounterValue), 1e6},
+			"system_usec":    {cgroupDesc("cpu_system_seconds_total", "CPU time consumed by the cgroup in system mode.", prometheus.CounterValue), 1e6},
+			"nr_periods":     {cgroupDesc("cpu_periods_total", "Number of enforcement periods that elapsed for the cgroup's CPU limit.", prometheus.CounterValue), 1},
+			"nr_throttled":   {cgroupDesc("cpu_throttled_periods_total", "Number of enforcement periods in which the cgroup was throttled.", prometheus.CounterValue), 1},
+			"throttled_usec": {cgroupDesc("cpu_throttled_seconds_total", "Total time the cgroup was throttled.", prometheus.CounterValue), 1e6},
+		},
+		memoryUsage:  cgroupDesc("memory_usage_bytes", "Memory currently used by the cgroup and its descendants.", prometheus.GaugeValue),
+		memoryMax:    cgroupDesc("memory_max_bytes", "Hard memory limit of the cgroup. Absent if unlimited.", prometheus.GaugeValue),
+		memoryHigh:   cgroupDesc("memory_high_bytes", "Memory throttling threshold of the cgroup. Absent if unlimited.", prometheus.GaugeValue),
+		memoryEvents: cgroupDesc("memory_events_total", "Number of memory events of the cgroup by type, from memory.events.", prometheus.CounterValue, "event"),
+		ioStat: map[string]typedDesc{
+			"rbytes": ioDesc("io_read_bytes_total", "Number of bytes read by the cgroup from the device."),
+			"wbytes": ioDesc("io_written_bytes_total", "Number of bytes written by the cgroup to the device."),
+			"rios":   ioDesc("io_reads_total", "Number of read operations of the cgroup on the device."),
+			"wios":   ioDesc("io_writes_total", "Number of write operations of the cgroup on the device."),
+			"dbytes": ioDesc("io_discarded_bytes_total", "Number of bytes discarded by the cgroup on the device."),
+			"dios":   ioDesc("io_discards_total", "Number of discard operations of the cgroup on the device."),
+		},
+		pids:    cgroupDesc("pids", "Number of processes in the cgroup and its descendants.", prometheus.GaugeValue),
+		pidsMax: cgroupDesc("pids_max", "Maximum number of processes allowed in the cgroup. Absent if unlimited.", prometheus.GaugeValue),
+	}
+	// cpuacct.stat is in USER_HZ ticks, which is fixed at 100 on Linux.
+	c.cpuacctStat = map[string]cgroupStatsKey{
+		"user":   {c.cpuStat["user_usec"].desc, 100},
+		"system": {c.cpuStat["system_usec"].desc, 100},
+	}
+	c.cpuStatV1 = map[string]cgroupStatsKey{
+		"nr_periods":     c.cpuStat["nr_periods"],
+		"nr_throttled":   c.cpuStat["nr_throttled"],
+		"throttled_time": {c.cpuStat["throttled_usec"].desc, 1e9},
+	}
+	c.memoryFailures = cgroupDesc("memory_failures_total", "Number of times the memory usage of the cgroup hit its limit, from cgroup v1 memory.failcnt.", prometheus.CounterValue)
+	c.memoryStat = cgroupDesc("memory_stat_bytes", "Memory used by the cgroup by type, from cgroup v1 memory.stat.", prometheus.GaugeValue, "type")
+	c.memoryFaults = map[string]typedDesc{
+		"pgfault":    cgroupDesc("memory_page_faults_total", "Number of page faults of the cgroup.", prometheus.CounterValue),
+		"pgmajfault": cgroupDesc("memory_major_page_faults_total", "Number of major page faults of the cgroup.", prometheus.CounterValue),
+	}
+	c.pressure = pressure
+	c.logger = logger
+	return c, nil
+}
+
+// Update implements Collector and exposes per-cgroup statistics.
+func (c *cgroupStatsCollector) Update(ch chan<- prometheus.Metric) error {
+	devices := map[string]string{}
+
+	hierarchies, err := cgroupV1Hierarchies()
+	if err != nil {
+		level.Debug(c.logger).Log("msg", "failed to find cgroup v1 hierarchies", "err", err)
+	}
+	// In hybrid mode a controller bound to a v1 hierarchy is exposed from
+	// there only. The unified tree still has its own cpu.stat, whose usage
+	// would otherwise duplicate the one of the cpuacct hierarchy.
+	v1 := map[string]bool{}
+	for _, h := range hierarchies {
+		for controller := range h.controllers {
+			v1[controller] = true
+		}
+	}
+
+	root, unified := cgroupUnifiedRoot()
+	if unified {
+		err := walkCgroups(root, c.maxDepth, c.filter, func(name, dir string) {
+			if !v1["cpu"] && !v1["cpuacct"] {
+				c.updateCPU(ch, name, dir)
+			}
+			if !v1["memory"] {
+				c.updateMemory(ch, name, dir)
+			}
+			if !v1["blkio"] {
+				c.updateIO(ch, name, dir, devices)
+			}
+			if !v1["pids"] {
+				c.updatePids(ch, name, dir)
+			}
+			c.updatePressure(ch, name, dir)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, h := range hierarchies {
+		if err := c.updateV1(ch, h, devices); err != nil {
+			return err
+		}
+	}
+
+	if !unified && len(hierarchies) == 0 {
+		level.Debug(c.logger).Log("msg", "no cgroup hierarchy found", "path", sysFilePath("fs/cgroup"))
+		return ErrNoData
+	}
+	return nil
+}
+
+func (c *cgroupStatsCollector) updateCPU(ch chan<- prometheus.Metric, name, dir string) {
+	c.updateKeyed(ch, name, dir, "cpu.stat", c.cpuStat)
+}
+
+// updateKeyed exposes the values of a flat keyed cgroup file found in keys.
+func (c *cgroupStatsCollector) updateKeyed(ch chan<- prometheus.Metric, name, dir, file string, keys map[string]cgroupStatsKey) {
+	stats, err := readCgroupKeyedFile(filepath.Join(dir, file))
+	if err != nil {
+		c.logReadError(err, name, file)
+		return
+	}
+	for key, value := range stats {
+		if k, ok := keys[key]; ok {
+			ch <- k.desc.mustNewConstMetric(float64(value)/k.divisor, name)
+		}
+	}
+}
+
+func (c *cgroupStatsCollector) updateMemory(ch chan<- prometheus.Metric, name, dir string) {
+	for file, desc := range map[string]typedDesc{
+		"memory.current": c.memoryUsage,
+		"memory.max":     c.memoryMax,
+		"memory.high":    c.memoryHigh,
+	} {
+		value, ok, err := readCgroupLimit(filepath.Join(dir, file))
+		if err != nil {
+			c.logReadError(err, name, file)
+			continue
+		}
+		if ok {
+			ch <- desc.mustNewConstMetric(value, name)
+		}
+	}
+
+	events, err := readCgroupKeyedFile(filepath.Join(dir, "memory.events"))
+	if err != nil {
+		c.logReadError(err, name, "memory.events")
+		return
+	}
+	for event, value := range events {
+		ch <- c.memoryEvents.mustNewConstMetric(float64(value), name, event)
+	}
+}
+
+func (c *cgroupStatsCollector) updateIO(ch chan<- prometheus.Metric, name, dir string, devices map[string]string) {
+	stats, err := readCgroupIOStat(filepath.Join(dir, "io.stat"))
+	if err != nil {
+		c.logReadError(err, name, "io.stat")
+		return
+	}
+	c.exportIO(ch, name, stats, devices)
+}
+
+// exportIO exposes per-device IO counters keyed like the fields of io.stat.
+func (c *cgroupStatsCollector) exportIO(ch chan<- prometheus.Metric, name string, stats map[string]map[string]uint64, devices map[string]string) {
+	for id, values := range stats {
+		device, ok := devices[id]
+		if !ok {
+			device = blockDeviceName(id)
+			devices[id] = device
+		}
+		for key, value := range values {
+			if desc, ok := c.ioStat[key]; ok {
+				ch <- desc.mustNewConstMetric(float64(value), name, device)
+			}
+		}
+	}
+}
+
+func (c *cgroupStatsCollector) updatePids(ch chan<- prometheus.Metric, name, dir string) {
+	for file, desc := range map[string]typedDesc{
+		"pids.current": c.pids,
+		"pids.max":     c.pidsMax,
+	} {
+		value, ok, err := readCgroupLimit(filepath.Join(dir, file))
+		if err != nil {
+			c.logReadError(err, name, file)
+			continue
+		}
+		if ok {
+			ch <- desc.mustNewConstMetric(value, name)
+		}
+	}
+}
+
+func (c *cgroupStatsCollector) updatePressure(ch chan<- prometheus.Metric, name, dir string) {
+	for resource, descs := range c.pressure {
+		file := resource + ".pressure"
+		totals, err := readPSITotals(filepath.Join(dir, file))
+		if err != nil {
+			c.logReadError(err, name, file)
+			continue
+		}
+		for kind, total := range totals {
+			if desc, ok := descs[kind]; ok {
+				ch <- desc.mustNewConstMetric(float64(total)/1e6, name)
+			}
+		}
+	}
+}
+
+// logReadError logs failures to read a cgroup file. Files of controllers not
+// enabled for the cgroup don't exist, which is not an error.
+func (c *cgroupStatsCollector) logReadError(err error, cgroup, file string) {
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	level.Debug(c.logger).Log("msg", "failed to read cgroup file", "cgroup", cgroup, "file", file, "err", err)
+}
+
+// cgroupUnifiedRoot returns the root of the cgroup v2 hierarchy, which is
+// either mounted on /sys/fs/cgroup or, in hybrid mode, below it.
+func cgroupUnifiedRoot() (string, bool) {
+	for _, dir := range []string{"fs/cgroup", "fs/cgroup/unified"} {
+		root := sysFilePath(dir)
+		if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+			return root, true
+		}
+	}
+	return "", false
+}
+
+// walkCgroups calls fn for every cgroup below root up to maxDepth levels deep
+// whose path is not filtered out. Filtered cgroups are still descended into.
+// The name passed to fn is the cgroup path as seen in /proc/<pid>/cgroup.
+func walkCgroups(root string, maxDepth int, filter deviceFilter, fn func(name, dir string)) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// The cgroup was removed while walking the hierarchy.
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name, depth := "/", 0
+		if rel != "." {
+			name = "/" + filepath.ToSlash(rel)
+			depth = strings.Count(name, "/")
+		}
+		if depth > maxDepth {
+			return filepath.SkipDir
+		}
+		if !filter.ignored(name) {
+			fn(name, path)
+		}
+		return nil
+	})
+}
+
+// readCgroupKeyedFile parses a flat keyed cgroup file such as cpu.stat, with
+// one "<key> <value>" pair per line.
+func readCgroupKeyedFile(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stats := map[string]uint64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid line %q in %s", scanner.Text(), path)
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value in %s: %w", path, err)
+		}
+		stats[fields[0]] = value
+	}
+	return stats, scanner.Err()
+}
+
+// readCgroupLimit reads a single value cgroup file. The returned bool is
+// false if the file contains "max", meaning no limit is set.
+func readCgroupLimit(path string) (float64, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false, err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, false, nil
+	}
+	v, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid value in %s: %w", path, err)
+	}
+	return float64(v), true, nil
+}
+
+// readCgroupIOStat parses a nested keyed io.stat file, with one
+// "<major>:<minor> <key>=<value>..." line per device.
+func readCgroupIOStat(path string) (map[string]map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stats := map[string]map[string]uint64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		values := map[string]uint64{}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid field %q in %s", field, path)
+			}
+			v, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value in %s: %w", path, err)
+			}
+			values[key] = v
+		}
+		stats[fields[0]] = values
+	}
+	return stats, scanner.Err()
+}
+
+// readPSITotals returns the total stall time in microseconds of the "some"
+// and "full" lines of a pressure stall information file.
+func readPSITotals(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	totals := map[string]uint64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			value, ok := strings.CutPrefix(field, "total=")
+			if !ok {
+				continue
+			}
+			total, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid total in %s: %w", path, err)
+			}
+			totals[fields[0]] = total
+		}
+	}
+	return totals, scanner.Err()
+}
+
+// blockDeviceName resolves a "<major>:<minor>" block device number to its
+// kernel name, falling back to the number itself.
+func blockDeviceName(id string) string {
+	target, err := os.Readlink(sysFilePath(filepath.Join("dev/block", id)))
+	if err != nil {
+		return id
+	}
+	return filepath.Base(target)
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nocgroupstats
+// +build !nocgroupstats
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type testCgroupStatsCollector struct {
+	cc Collector
+}
+
+func (c testCgroupStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.cc.Update(ch)
+}
+
+func (c testCgroupStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func TestCgroupStatsV1(t *testing.T) {
+	expected := `# HELP node_cgroup_cpu_periods_total Number of enforcement periods that elapsed for the cgroup's CPU limit.
+# TYPE node_cgroup_cpu_periods_total counter
+node_cgroup_cpu_periods_total{cgroup="/system.slice/sshd.service"} 1520
+# HELP node_cgroup_cpu_system_seconds_total CPU time consumed by the cgroup in system mode.
+# TYPE node_cgroup_cpu_system_seconds_total counter
+node_cgroup_cpu_system_seconds_total{cgroup="/system.slice/sshd.service"} 14.47
+# HELP node_cgroup_cpu_throttled_periods_total Number of enforcement periods in which the cgroup was throttled.
+# TYPE node_cgroup_cpu_throttled_periods_total counter
+node_cgroup_cpu_throttled_periods_total{cgroup="/system.slice/sshd.service"} 32
+# HELP node_cgroup_cpu_throttled_seconds_total Total time the cgroup was throttled.
+# TYPE node_cgroup_cpu_throttled_seconds_total counter
+node_cgroup_cpu_throttled_seconds_total{cgroup="/system.slice/sshd.service"} 1.843
+# HELP node_cgroup_cpu_usage_seconds_total Total CPU time consumed by the cgroup.
+# TYPE node_cgroup_cpu_usage_seconds_total counter
+node_cgroup_cpu_usage_seconds_total{cgroup="/system.slice/sshd.service"} 24.591
+# HELP node_cgroup_cpu_user_seconds_total CPU time consumed by the cgroup in user mode.
+# TYPE node_cgroup_cpu_user_seconds_total counter
+node_cgroup_cpu_user_seconds_total{cgroup="/system.slice/sshd.service"} 10.12
+# HELP node_cgroup_io_discarded_bytes_total Number of bytes discarded by the cgroup on the device.
+# TYPE node_cgroup_io_discarded_bytes_total counter
+node_cgroup_io_discarded_bytes_total{cgroup="/system.slice/sshd.service",device="sda"} 0
+# HELP node_cgroup_io_discards_total Number of discard operations of the cgroup on the device.
+# TYPE node_cgroup_io_discards_total counter
+node_cgroup_io_discards_total{cgroup="/system.slice/sshd.service",device="sda"} 0
+# HELP node_cgroup_io_read_bytes_total Number of bytes read by the cgroup from the device.
+# TYPE node_cgroup_io_read_bytes_total counter
+node_cgroup_io_read_bytes_total{cgroup="/system.slice/sshd.service",device="sda"} 1.8632704e+07
+# HELP node_cgroup_io_reads_total Number of read operations of the cgroup on the device.
+# TYPE node_cgroup_io_reads_total counter
+node_cgroup_io_reads_total{cgroup="/system.slice/sshd.service",device="sda"} 412
+# HELP node_cgroup_io_writes_total Number of write operations of the cgroup on the device.
+# TYPE node_cgroup_io_writes_total counter
+node_cgroup_io_writes_total{cgroup="/system.slice/sshd.service",device="sda"} 1
+# HELP node_cgroup_io_written_bytes_total Number of bytes written by the cgroup to the device.
+# TYPE node_cgroup_io_written_bytes_total counter
+node_cgroup_io_written_bytes_total{cgroup="/system.slice/sshd.service",device="sda"} 4096
+# HELP node_cgroup_memory_failures_total Number of times the memory usage of the cgroup hit its limit, from cgroup v1 memory.failcnt.
+# TYPE node_cgroup_memory_failures_total counter
+node_cgroup_memory_failures_total{cgroup="/system.slice/sshd.service"} 17
+# HELP node_cgroup_memory_major_page_faults_total Number of major page faults of the cgroup.
+# TYPE node_cgroup_memory_major_page_faults_total counter
+node_cgroup_memory_major_page_faults_total{cgroup="/system.slice/sshd.service"} 3
+# HELP node_cgroup_memory_max_bytes Hard memory limit of the cgroup. Absent if unlimited.
+# TYPE node_cgroup_memory_max_bytes gauge
+node_cgroup_memory_max_bytes{cgroup="/system.slice/sshd.service"} 5.36870912e+08
+# HELP node_cgroup_memory_page_faults_total Number of page faults of the cgroup.
+# TYPE node_cgroup_memory_page_faults_total counter
+node_cgroup_memory_page_faults_total{cgroup="/system.slice/sshd.service"} 2210
+# HELP node_cgroup_memory_stat_bytes Memory used by the cgroup by type, from cgroup v1 memory.stat.
+# TYPE node_cgroup_memory_stat_bytes gauge
+node_cgroup_memory_stat_bytes{cgroup="/system.slice/sshd.service",type="active_anon"} 4.780032e+06
+node_cgroup_memory_stat_bytes{cgroup="/system.slice/sshd.service",type="active_file"} 0
+node_cgroup_memory_stat_bytes{cgroup="/system.slice/sshd.service",type="cache"} 4.194304e+06
+node_cgroup_memory_stat_bytes{cgroup="/system.slice/sshd.service",type="dirty"} 0
+node_cgroup_memory_stat_bytes{cgroup="/system.slice/sshd.service",type="inactive_anon"} 0
+node_cgroup_memory_stat_bytes{cgroup="/system.slice/sshd.service",type="inactive_file"} 4.194304e+06
+node_cgroup_memory_stat_bytes{cgroup="/system.slice/sshd.service",type="mapped_file"} 1.048576e+06
+node_cgroup_memory_stat_bytes{cgroup="/system.slice/sshd.service",type="rss"} 4.780032e+06
+node_cgroup_memory_stat_bytes{cgroup="/system.slice/sshd.service",type="rss_huge"} 0
+node_cgroup_memory_stat_bytes{cgroup="/system.slice/sshd.service",type="shmem"} 0
+node_cgroup_memory_stat_bytes{cgroup="/system.slice/sshd.service",type="swap"} 0
+node_cgroup_memory_stat_bytes{cgroup="/system.slice/sshd.service",type="unevictable"} 0
+node_cgroup_memory_stat_bytes{cgroup="/system.slice/sshd.service",type="writeback"} 0
+# HELP node_cgroup_memory_usage_bytes Memory currently used by the cgroup and its descendants.
+# TYPE node_cgroup_memory_usage_bytes gauge
+node_cgroup_memory_usage_bytes{cgroup="/system.slice/sshd.service"} 8.974336e+06
+# HELP node_cgroup_pids Number of processes in the cgroup and its descendants.
+# TYPE node_cgroup_pids gauge
+node_cgroup_pids{cgroup="/system.slice/sshd.service"} 3
+# HELP node_cgroup_pids_max Maximum number of processes allowed in the cgroup. Absent if unlimited.
+# TYPE node_cgroup_pids_max gauge
+node_cgroup_pids_max{cgroup="/system.slice/sshd.service"} 100
+`
+	oldProcPath, oldSysPath, oldRootfsPath := *procPath, *sysPath, *rootfsPath
+	defer func() {
+		*procPath, *sysPath, *rootfsPath = oldProcPath, oldSysPath, oldRootfsPath
+		*cgroupStatsInclude = ""
+	}()
+	*procPath = "fixtures/cgroupv1/proc"
+	*sysPath = "fixtures/cgroupv1/sys"
+	*rootfsPath = "fixtures/cgroupv1"
+	*cgroupStatsMaxDepth = 2
+	*cgroupStatsInclude = "^/system.slice/sshd.service$"
+
+	c, err := NewCgroupStatsCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&testCgroupStatsCollector{cc: c})
+
+	err = testutil.GatherAndCompare(reg, strings.NewReader(expected))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nocgroupstats
+// +build !nocgroupstats
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+// cgroupV1Unlimited is the smallest value treated as "no limit" in cgroup v1
+// limit files, which report an unset limit as the largest page aligned int64.
+const cgroupV1Unlimited = 1 << 62
+
+// cgroupV1Controllers are the cgroup v1 controllers the collector reads.
+var cgroupV1Controllers = []string{"blkio", "cpu", "cpuacct", "memory", "pids"}
+
+// cgroupV1MemoryStat are the byte valued memory.stat keys that are exposed.
+var cgroupV1MemoryStat = []string{
+	"active_anon", "active_file", "cache", "dirty", "inactive_anon", "inactive_file",
+	"mapped_file", "rss", "rss_huge", "shmem", "swap", "unevictable", "writeback",
+}
+
+// cgroupV1Hierarchy is a mounted cgroup v1 hierarchy with the controllers
+// bound to it.
+type cgroupV1Hierarchy struct {
+	root        string
+	controllers map[string]bool
+}
+
+// cgroupV1Hierarchies returns the cgroup v1 hierarchies of the controllers
+// the collector reads, based on the mount table of the host.
+func cgroupV1Hierarchies() ([]cgroupV1Hierarchy, error) {
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open procfs: %w", err)
+	}
+	var mounts []*procfs.MountInfo
+	if p, err := fs.Proc(1); err == nil {
+		mounts, _ = p.MountInfo()
+	}
+	if mounts == nil {
+		// Fall back to our own mount table if /proc/1 is hidden by hidepid.
+		p, err := fs.Self()
+		if err != nil {
+			return nil, err
+		}
+		if mounts, err = p.MountInfo(); err != nil {
+			return nil, err
+		}
+	}
+
+	var hierarchies []cgroupV1Hierarchy
+	seen := map[string]bool{}
+	for _, m := range mounts {
+		if m.FSType != "cgroup" {
+			continue
+		}
+		controllers := map[string]bool{}
+		for _, controller := range cgroupV1Controllers {
+			// The same hierarchy may be mounted more than once.
+			if _, ok := m.SuperOptions[controller]; ok && !seen[controller] {
+				controllers[controller] = true
+				seen[controller] = true
+			}
+		}
+		if len(controllers) == 0 {
+			continue
+		}
+		hierarchies = append(hierarchies, cgroupV1Hierarchy{
+			root:        rootfsFilePath(m.MountPoint),
+			controllers: controllers,
+		})
+	}
+	sort.Slice(hierarchies, func(i, j int) bool { return hierarchies[i].root < hierarchies[j].root })
+	return hierarchies, nil
+}
+
+func (c *cgroupStatsCollector) updateV1(ch chan<- prometheus.Metric, h cgroupV1Hierarchy, devices map[string]string) error {
+	return walkCgroups(h.root, c.maxDepth, c.filter, func(name, dir string) {
+		if h.controllers["cpuacct"] {
+			c.updateCPUAcct(ch, name, dir)
+		}
+		if h.controllers["cpu"] {
+			c.updateKeyed(ch, name, dir, "cpu.stat", c.cpuStatV1)
+		}
+		if h.controllers["memory"] {
+			c.updateMemoryV1(ch, name, dir)
+		}
+		if h.controllers["blkio"] {
+			c.updateBlkio(ch, name, dir, devices)
+		}
+		if h.controllers["pids"] {
+			c.updatePids(ch, name, dir)
+		}
+	})
+}
+
+func (c *cgroupStatsCollector) updateCPUAcct(ch chan<- prometheus.Metric, name, dir string) {
+	usage, _, err := readCgroupLimit(filepath.Join(dir, "cpuacct.usage"))
+	if err != nil {
+		c.logReadError(err, name, "cpuacct.usage")
+	} else {
+		k := c.cpuStat["usage_usec"]
+		ch <- k.desc.mustNewConstMetric(usage/1e9, name)
+	}
+	c.updateKeyed(ch, name, dir, "cpuacct.stat", c.cpuacctStat)
+}
+
+func (c *cgroupStatsCollector) updateMemoryV1(ch chan<- prometheus.Metric, name, dir string) {
+	for file, desc := range map[string]typedDesc{
+		"memory.usage_in_bytes": c.memoryUsage,
+		"memory.limit_in_bytes": c.memoryMax,
+		"memory.failcnt":        c.memoryFailures,
+	} {
+		value, _, err := readCgroupLimit(filepath.Join(dir, file))
+		if err != nil {
+			c.logReadError(err, name, file)
+			continue
+		}
+		if file == "memory.limit_in_bytes" && value >= cgroupV1Unlimited {
+			continue
+		}
+		ch <- desc.mustNewConstMetric(value, name)
+	}
+
+	stats, err := readCgroupKeyedFile(filepath.Join(dir, "memory.stat"))
+	if err != nil {
+		c.logReadError(err, name, "memory.stat")
+		return
+	}
+	for _, key := range cgroupV1MemoryStat {
+		// Prefer the hierarchical value, which matches memory.usage_in_bytes
+		// in including descendants.
+		value, ok := stats["total_"+key]
+		if !ok {
+			value, ok = stats[key]
+		}
+		if ok {
+			ch <- c.memoryStat.mustNewConstMetric(float64(value), name, key)
+		}
+	}
+	for key, desc := range c.memoryFaults {
+		if value, ok := stats[key]; ok {
+			ch <- desc.mustNewConstMetric(float64(value), name)
+		}
+	}
+}
+
+func (c *cgroupStatsCollector) updateBlkio(ch chan<- prometheus.Metric, name, dir string, devices map[string]string) {
+	// Translate the throttle statistics, which are accounted independently
+	// of the IO scheduler, to the keys of the cgroup v2 io.stat file.
+	stats := map[string]map[string]uint64{}
+	for file, keys := range map[string]map[string]string{
+		"blkio.throttle.io_service_bytes": {"Read": "rbytes", "Write": "wbytes", "Discard": "dbytes"},
+		"blkio.throttle.io_serviced":      {"Read": "rios", "Write": "wios", "Discard": "dios"},
+	} {
+		if err := readCgroupBlkioStat(filepath.Join(dir, file), keys, stats); err != nil {
+			c.logReadError(err, name, file)
+		}
+	}
+	c.exportIO(ch, name, stats, devices)
+}
+
+// readCgroupBlkioStat parses a blkio statistics file, with one
+// "<major>:<minor> <operation> <value>" line per device and operation, and
+// adds the operations found in keys to stats.
+func readCgroupBlkioStat(path string, keys map[string]string, stats map[string]map[string]uint64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// Skip the trailing "Total <value>" line.
+		if len(fields) != 3 {
+			continue
+		}
+		key, ok := keys[fields[1]]
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value in %s: %w", path, err)
+		}
+		if stats[fields[0]] == nil {
+			stats[fields[0]] = map[string]uint64{}
+		}
+		stats[fields[0]][key] = value
+	}
+	return scanner.Err()
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 // Namespace defines the common namespace to be used by all metrics.
@@ -183,6 +184,77 @@ type Collector interface {
 	Update(ch chan<- prometheus.Metric) error
 }
 
+// knownNamesCollector is a collector that checks its metric names against
+// those of the other collectors of the same scrape.
+type knownNamesCollector interface {
+	Collector
+	// checksNames returns whether the collector needs the known names.
+	checksNames() bool
+	// updateKnownNames is Update, given the names of the metric families
+	// the other collectors exported.
+	updateKnownNames(ch chan<- prometheus.Metric, known map[string]bool) error
+}
+
+// knownNamesUpdater updates a knownNamesCollector with a set of known names.
+type knownNamesUpdater struct {
+	c     knownNamesCollector
+	known map[string]bool
+}
+
+func (u knownNamesUpdater) Update(ch chan<- prometheus.Metric) error {
+	return u.c.updateKnownNames(ch, u.known)
+}
+
+// NewNodeGatherer registers n with r and returns a Gatherer of r. Collectors
+// checking their metric names against the other collectors are gathered after
+// r, given the names of the metric families r gathered in the same scrape.
+func NewNodeGatherer(n *NodeCollector, r *prometheus.Registry) (prometheus.Gatherer, error) {
+	others := NodeCollector{Collectors: map[string]Collector{}, logger: n.logger}
+	checking := map[string]knownNamesCollector{}
+	for name, c := range n.Collectors {
+		if kc, ok := c.(knownNamesCollector); ok && kc.checksNames() {
+			checking[name] = kc
+			continue
+		}
+		others.Collectors[name] = c
+	}
+	if err := r.Register(others); err != nil {
+		return nil, err
+	}
+	if len(checking) == 0 {
+		return r, nil
+	}
+	return nodeGatherer{registry: r, checking: checking, logger: n.logger}, nil
+}
+
+type nodeGatherer struct {
+	registry *prometheus.Registry
+	checking map[string]knownNamesCollector
+	logger   log.Logger
+}
+
+// Gather implements the prometheus.Gatherer interface.
+func (g nodeGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.registry.Gather()
+	known := make(map[string]bool, len(mfs))
+	for _, mf := range mfs {
+		known[mf.GetName()] = true
+	}
+
+	checking := NodeCollector{Collectors: map[string]Collector{}, logger: g.logger}
+	for name, c := range g.checking {
+		checking.Collectors[name] = knownNamesUpdater{c: c, known: known}
+	}
+	r := prometheus.NewRegistry()
+	if err := r.Register(checking); err != nil {
+		return nil, err
+	}
+	return prometheus.Gatherers{
+		prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return mfs, err }),
+		r,
+	}.Gather()
+}
+
 type typedDesc struct {
 	desc      *prometheus.Desc
 	valueType prometheus.ValueType
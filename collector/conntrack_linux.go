@@ -20,11 +20,67 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 
+	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/mdlayher/netlink"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/procfs"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// ctnetlink messages and attributes of
+	// include/uapi/linux/netfilter/nfnetlink_conntrack.h.
+	ipctnlMsgCtGet       = 1
+	ipctnlMsgExpGet      = 1
+	ctaTupleOrig         = 1
+	ctaProtoinfo         = 4
+	ctaZone              = 18
+	ctaTupleProto        = 2
+	ctaProtoNum          = 1
+	ctaProtoinfoTCP      = 1
+	ctaProtoinfoTCPState = 1
+
+	conntrackDefaultZone = 0
+	// State of TCP entries with a state unknown to the collector.
+	conntrackUnknownState = "unknown"
+)
+
+var (
+	conntrackPerCPU           = kingpin.Flag("collector.conntrack.per-cpu", "Expose the conntrack statistics per CPU.").Bool()
+	conntrackEntriesBreakdown = kingpin.Flag("collector.conntrack.entries-breakdown", "Dump the connection tracking table to count the entries by protocol, TCP state and zone, and count the expectations. Expensive on large tables.").Bool()
+	conntrackFixtures         = kingpin.Flag("collector.conntrack.fixtures", "test fixtures to use for conntrack collector end-to-end testing").Default("").String()
+
+	// Names of the L4 protocols as shown in /proc/net/nf_conntrack.
+	conntrackProtocols = map[uint8]string{
+		unix.IPPROTO_TCP:     "tcp",
+		unix.IPPROTO_UDP:     "udp",
+		unix.IPPROTO_UDPLITE: "udplite",
+		unix.IPPROTO_ICMP:    "icmp",
+		unix.IPPROTO_ICMPV6:  "icmpv6",
+		unix.IPPROTO_SCTP:    "sctp",
+		unix.IPPROTO_DCCP:    "dccp",
+		unix.IPPROTO_GRE:     "gre",
+	}
+
+	// Names of enum tcp_conntrack of
+	// include/uapi/linux/netfilter/nf_conntrack_tcp.h.
+	conntrackTCPStates = []string{
+		"none",
+		"syn_sent",
+		"syn_recv",
+		"established",
+		"fin_wait",
+		"close_wait",
+		"last_ack",
+		"time_wait",
+		"close",
+		"syn_sent2",
+	}
 )
 
 type conntrackCollector struct {
@@ -38,7 +94,23 @@ type conntrackCollector struct {
 	drop          *prometheus.Desc
 	earlyDrop     *prometheus.Desc
 	searchRestart *prometheus.Desc
-	logger        log.Logger
+	expectLimit   *prometheus.Desc
+
+	cpuFound         typedDesc
+	cpuInvalid       typedDesc
+	cpuIgnore        typedDesc
+	cpuInsert        typedDesc
+	cpuInsertFailed  typedDesc
+	cpuDrop          typedDesc
+	cpuEarlyDrop     typedDesc
+	cpuSearchRestart typedDesc
+
+	protocolEntries typedDesc
+	tcpStateEntries typedDesc
+	zoneEntries     typedDesc
+	expectEntries   typedDesc
+
+	logger log.Logger
 }
 
 type conntrackStatistics struct {
@@ -52,12 +124,28 @@ type conntrackStatistics struct {
 	searchRestart uint64 // Number of conntrack table lookups which had to be restarted due to hashtable resizes
 }
 
+// conntrackEntryCounts are the numbers of connection tracking entries.
+type conntrackEntryCounts struct {
+	protocols map[string]uint64 // By L4 protocol
+	tcpStates map[string]uint64 // Of TCP entries by state
+	zones     map[uint16]uint64 // By zone
+}
+
 func init() {
 	registerCollector("conntrack", defaultEnabled, NewConntrackCollector)
 }
 
 // NewConntrackCollector returns a new Collector exposing conntrack stats.
 func NewConntrackCollector(logger log.Logger) (Collector, error) {
+	desc := func(name, help string, valueType prometheus.ValueType, labels ...string) typedDesc {
+		return typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", name),
+			help, labels, nil,
+		), valueType}
+	}
+	cpuDesc := func(name, help string) typedDesc {
+		return desc("nf_conntrack_cpu_stat_"+name+"_total", help, prometheus.CounterValue, "cpu")
+	}
 	return &conntrackCollector{
 		current: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "nf_conntrack_entries"),
@@ -109,11 +197,37 @@ func NewConntrackCollector(logger log.Logger) (Collector, error) {
 			"Number of conntrack table lookups which had to be restarted due to hashtable resizes.",
 			nil, nil,
 		),
+		expectLimit: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "nf_conntrack_expect_entries_limit"),
+			"Maximum size of connection tracking expectation table.",
+			nil, nil,
+		),
+
+		cpuFound:         cpuDesc("found", "Number of searched entries which were successful, per CPU."),
+		cpuInvalid:       cpuDesc("invalid", "Number of packets seen which can not be tracked, per CPU."),
+		cpuIgnore:        cpuDesc("ignore", "Number of packets seen which are already connected to a conntrack entry, per CPU."),
+		cpuInsert:        cpuDesc("insert", "Number of entries inserted into the list, per CPU."),
+		cpuInsertFailed:  cpuDesc("insert_failed", "Number of entries for which list insertion was attempted but failed, per CPU."),
+		cpuDrop:          cpuDesc("drop", "Number of packets dropped due to conntrack failure, per CPU."),
+		cpuEarlyDrop:     cpuDesc("early_drop", "Number of dropped conntrack entries to make room for new ones, per CPU."),
+		cpuSearchRestart: cpuDesc("search_restart", "Number of conntrack table lookups which had to be restarted due to hashtable resizes, per CPU."),
+
+		protocolEntries: desc("nf_conntrack_protocol_entries", "Number of connection tracking entries by L4 protocol.", prometheus.GaugeValue, "protocol"),
+		tcpStateEntries: desc("nf_conntrack_tcp_state_entries", "Number of TCP connection tracking entries by state.", prometheus.GaugeValue, "state"),
+		zoneEntries:     desc("nf_conntrack_zone_entries", "Number of connection tracking entries by zone.", prometheus.GaugeValue, "zone"),
+		expectEntries:   desc("nf_conntrack_expect_entries", "Number of connection tracking expectations.", prometheus.GaugeValue),
+
 		logger: logger,
 	}, nil
 }
 
 func (c *conntrackCollector) Update(ch chan<- prometheus.Metric) error {
+	return forEachNetNamespace(ch, c.logger, c.update)
+}
+
+func (c *conntrackCollector) update(ch chan<- prometheus.Metric, ns netNamespace) error {
+	// The network sysctls under /proc/sys are those of the namespace of the
+	// calling thread.
 	value, err := readUintFromFile(procFilePath("sys/net/netfilter/nf_conntrack_count"))
 	if err != nil {
 		return c.handleErr(err)
@@ -128,10 +242,22 @@ func (c *conntrackCollector) Update(ch chan<- prometheus.Metric) error {
 	ch <- prometheus.MustNewConstMetric(
 		c.limit, prometheus.GaugeValue, float64(value))
 
-	conntrackStats, err := getConntrackStatistics()
+	value, err = readUintFromFile(procFilePath("sys/net/netfilter/nf_conntrack_expect_max"))
+	if err != nil {
+		return c.handleErr(err)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.expectLimit, prometheus.GaugeValue, float64(value))
+
+	fs, err := ns.procFS()
+	if err != nil {
+		return fmt.Errorf("failed to open procfs: %w", err)
+	}
+	connStats, err := fs.ConntrackStat()
 	if err != nil {
 		return c.handleErr(err)
 	}
+	conntrackStats := getConntrackStatistics(connStats)
 
 	ch <- prometheus.MustNewConstMetric(
 		c.found, prometheus.GaugeValue, float64(conntrackStats.found))
@@ -149,6 +275,47 @@ func (c *conntrackCollector) Update(ch chan<- prometheus.Metric) error {
 		c.earlyDrop, prometheus.GaugeValue, float64(conntrackStats.earlyDrop))
 	ch <- prometheus.MustNewConstMetric(
 		c.searchRestart, prometheus.GaugeValue, float64(conntrackStats.searchRestart))
+
+	if *conntrackPerCPU {
+		// There is a line for each possible CPU.
+		for i, connStat := range connStats {
+			cpu := strconv.Itoa(i)
+			ch <- c.cpuFound.mustNewConstMetric(float64(connStat.Found), cpu)
+			ch <- c.cpuInvalid.mustNewConstMetric(float64(connStat.Invalid), cpu)
+			ch <- c.cpuIgnore.mustNewConstMetric(float64(connStat.Ignore), cpu)
+			ch <- c.cpuInsert.mustNewConstMetric(float64(connStat.Insert), cpu)
+			ch <- c.cpuInsertFailed.mustNewConstMetric(float64(connStat.InsertFailed), cpu)
+			ch <- c.cpuDrop.mustNewConstMetric(float64(connStat.Drop), cpu)
+			ch <- c.cpuEarlyDrop.mustNewConstMetric(float64(connStat.EarlyDrop), cpu)
+			ch <- c.cpuSearchRestart.mustNewConstMetric(float64(connStat.SearchRestart), cpu)
+		}
+	}
+
+	if *conntrackEntriesBreakdown {
+		return c.updateEntries(ch)
+	}
+	return nil
+}
+
+func (c *conntrackCollector) updateEntries(ch chan<- prometheus.Metric) error {
+	counts, expectations, err := getConntrackEntryCounts(*conntrackFixtures)
+	if err != nil {
+		return err
+	}
+
+	for protocol, n := range counts.protocols {
+		ch <- c.protocolEntries.mustNewConstMetric(float64(n), protocol)
+	}
+	for _, state := range conntrackTCPStates {
+		ch <- c.tcpStateEntries.mustNewConstMetric(float64(counts.tcpStates[state]), state)
+	}
+	if n, ok := counts.tcpStates[conntrackUnknownState]; ok {
+		ch <- c.tcpStateEntries.mustNewConstMetric(float64(n), conntrackUnknownState)
+	}
+	for zone, n := range counts.zones {
+		ch <- c.zoneEntries.mustNewConstMetric(float64(n), strconv.Itoa(int(zone)))
+	}
+	ch <- c.expectEntries.mustNewConstMetric(float64(expectations))
 	return nil
 }
 
@@ -160,19 +327,9 @@ func (c *conntrackCollector) handleErr(err error) error {
 	return fmt.Errorf("failed to retrieve conntrack stats: %w", err)
 }
 
-func getConntrackStatistics() (*conntrackStatistics, error) {
+func getConntrackStatistics(connStats []procfs.ConntrackStatEntry) *conntrackStatistics {
 	c := conntrackStatistics{}
 
-	fs, err := procfs.NewFS(*procPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open procfs: %w", err)
-	}
-
-	connStats, err := fs.ConntrackStat()
-	if err != nil {
-		return nil, err
-	}
-
 	for _, connStat := range connStats {
 		c.found += connStat.Found
 		c.invalid += connStat.Invalid
@@ -184,5 +341,143 @@ func getConntrackStatistics() (*conntrackStatistics, error) {
 		c.searchRestart += connStat.SearchRestart
 	}
 
-	return &c, nil
+	return &c
+}
+
+// getConntrackEntryCounts counts the connection tracking entries and
+// expectations of the namespace of the calling thread as they are dumped,
+// or reads the dumps from the fixtures directory.
+func getConntrackEntryCounts(fixtures string) (*conntrackEntryCounts, int, error) {
+	if fixtures != "" {
+		entries, err := readNetlinkMessages(filepath.Join(fixtures, "entries"))
+		if err != nil {
+			return nil, 0, err
+		}
+		expectations, err := readNetlinkMessages(filepath.Join(fixtures, "expectations"))
+		if err != nil {
+			return nil, 0, err
+		}
+		counts, err := countConntrackEntries(entries)
+		if err != nil {
+			return nil, 0, fmt.Errorf("couldn't parse conntrack entries: %w", err)
+		}
+		return counts, len(expectations), nil
+	}
+
+	conn, err := netlink.Dial(unix.NETLINK_NETFILTER, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+
+	counts := newConntrackEntryCounts()
+	if err := nfnetlinkDumpFunc(conn, unix.NFNL_SUBSYS_CTNETLINK, ipctnlMsgCtGet, counts.add); err != nil {
+		return nil, 0, fmt.Errorf("couldn't dump conntrack entries: %w", err)
+	}
+	// Each expectation is a message of its own.
+	var expectations int
+	err = nfnetlinkDumpFunc(conn, unix.NFNL_SUBSYS_CTNETLINK_EXP, ipctnlMsgExpGet, func(netlink.Message) error {
+		expectations++
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("couldn't dump conntrack expectations: %w", err)
+	}
+	return counts, expectations, nil
+}
+
+// newConntrackEntryCounts returns counts of zero for the known protocols and
+// the default zone, so that their series don't vanish while they are empty.
+func newConntrackEntryCounts() *conntrackEntryCounts {
+	counts := conntrackEntryCounts{
+		protocols: map[string]uint64{},
+		tcpStates: map[string]uint64{},
+		zones:     map[uint16]uint64{conntrackDefaultZone: 0},
+	}
+	for _, name := range conntrackProtocols {
+		counts.protocols[name] = 0
+	}
+	return &counts
+}
+
+// countConntrackEntries counts the entries of a ctnetlink dump by L4
+// protocol, TCP state and zone.
+func countConntrackEntries(msgs []netlink.Message) (*conntrackEntryCounts, error) {
+	counts := newConntrackEntryCounts()
+	for _, m := range msgs {
+		if err := counts.add(m); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// add counts an entry of a ctnetlink dump.
+func (counts *conntrackEntryCounts) add(m netlink.Message) error {
+	ad, err := nfnetlinkAttributes(m)
+	if err != nil {
+		return err
+	}
+	var protocol uint8
+	tcpState := -1
+	zone := uint16(conntrackDefaultZone)
+	for ad.Next() {
+		switch ad.Type() {
+		case ctaTupleOrig:
+			ad.Nested(func(tad *netlink.AttributeDecoder) error {
+				for tad.Next() {
+					if tad.Type() != ctaTupleProto {
+						continue
+					}
+					tad.Nested(func(pad *netlink.AttributeDecoder) error {
+						for pad.Next() {
+							if pad.Type() == ctaProtoNum {
+								protocol = pad.Uint8()
+							}
+						}
+						return pad.Err()
+					})
+				}
+				return tad.Err()
+			})
+		case ctaProtoinfo:
+			ad.Nested(func(pad *netlink.AttributeDecoder) error {
+				for pad.Next() {
+					if pad.Type() != ctaProtoinfoTCP {
+						continue
+					}
+					pad.Nested(func(tad *netlink.AttributeDecoder) error {
+						for tad.Next() {
+							if tad.Type() == ctaProtoinfoTCPState {
+								tcpState = int(tad.Uint8())
+							}
+						}
+						return tad.Err()
+					})
+				}
+				return pad.Err()
+			})
+		case ctaZone:
+			// Only present for entries outside the default zone.
+			zone = ad.Uint16()
+		}
+	}
+	if err := ad.Err(); err != nil {
+		return err
+	}
+
+	name, ok := conntrackProtocols[protocol]
+	if !ok {
+		name = strconv.Itoa(int(protocol))
+	}
+	counts.protocols[name]++
+	if protocol == unix.IPPROTO_TCP {
+		state := conntrackUnknownState
+		if tcpState >= 0 && tcpState < len(conntrackTCPStates) {
+			state = conntrackTCPStates[tcpState]
+		}
+		counts.tcpStates[state]++
+	}
+	counts.zones[zone]++
+	return nil
 }
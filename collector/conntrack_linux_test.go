@@ -0,0 +1,56 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noconntrack
+// +build !noconntrack
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCountConntrackEntries(t *testing.T) {
+	msgs, err := readNetlinkMessages("fixtures/conntrack/entries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts, err := countConntrackEntries(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &conntrackEntryCounts{
+		protocols: map[string]uint64{"tcp": 6, "udp": 2, "udplite": 0, "icmp": 1, "icmpv6": 1, "sctp": 0, "dccp": 0, "gre": 0},
+		tcpStates: map[string]uint64{"established": 4, "syn_sent": 1, "time_wait": 1},
+		zones:     map[uint16]uint64{0: 8, 1: 2},
+	}
+	if !reflect.DeepEqual(want, counts) {
+		t.Errorf("want %+v, got %+v", want, counts)
+	}
+}
+
+func TestCountConntrackEntriesEmpty(t *testing.T) {
+	counts, err := countConntrackEntries(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The known protocols and the default zone are kept at zero.
+	if n, ok := counts.protocols["tcp"]; !ok || n != 0 {
+		t.Errorf("want 0 tcp entries, got %d (present %t)", n, ok)
+	}
+	if n, ok := counts.zones[0]; !ok || n != 0 {
+		t.Errorf("want 0 entries in zone 0, got %d (present %t)", n, ok)
+	}
+}
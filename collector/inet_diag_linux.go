@@ -0,0 +1,158 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/mdlayher/netlink"
+)
+
+const (
+	// sockDiagByFamily is SOCK_DIAG_BY_FAMILY, the request type of all
+	// sock_diag requests.
+	sockDiagByFamily = 20
+	// tcpfAll selects sockets in any TCP state.
+	tcpfAll = 0xFFF
+
+	// sizeOfInetDiagMsg is the size of struct inet_diag_msg, which the
+	// attributes of a socket follow.
+	sizeOfInetDiagMsg = 72
+
+	// Attributes of inet_diag messages, requested by setting bit type-1 of
+	// InetDiagReqV2.Ext.
+	inetDiagInfo      = 2
+	inetDiagSKMemInfo = 7
+)
+
+// sockDiagRequest is a request of the sock_diag netlink protocol.
+type sockDiagRequest interface {
+	Serialize() []byte
+}
+
+// sockDiagDump returns the sockets matching a sock_diag request, dumped in
+// the network namespace of the calling thread.
+func sockDiagDump(req sockDiagRequest) ([]netlink.Message, error) {
+	conn, err := netlink.Dial(syscall.NETLINK_INET_DIAG, nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't connect netlink: %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Execute(netlink.Message{
+		Header: netlink.Header{
+			Type:  sockDiagByFamily,
+			Flags: syscall.NLM_F_REQUEST | syscall.NLM_F_DUMP,
+		},
+		Data: req.Serialize(),
+	})
+}
+
+// InetDiagSockID (inet_diag_sockid) contains the socket identity.
+// https://github.com/torvalds/linux/blob/v4.0/include/uapi/linux/inet_diag.h#L13
+type InetDiagSockID struct {
+	SourcePort [2]byte
+	DestPort   [2]byte
+	SourceIP   [4][4]byte
+	DestIP     [4][4]byte
+	Interface  uint32
+	Cookie     [2]uint32
+}
+
+// InetDiagReqV2 (inet_diag_req_v2) is used to request diagnostic data.
+// https://github.com/torvalds/linux/blob/v4.0/include/uapi/linux/inet_diag.h#L37
+type InetDiagReqV2 struct {
+	Family   uint8
+	Protocol uint8
+	Ext      uint8
+	Pad      uint8
+	States   uint32
+	ID       InetDiagSockID
+}
+
+const sizeOfDiagRequest = 0x38
+
+func (req *InetDiagReqV2) Serialize() []byte {
+	return (*(*[sizeOfDiagRequest]byte)(unsafe.Pointer(req)))[:]
+}
+
+func (req *InetDiagReqV2) Len() int {
+	return sizeOfDiagRequest
+}
+
+type InetDiagMsg struct {
+	Family  uint8
+	State   uint8
+	Timer   uint8
+	Retrans uint8
+	ID      InetDiagSockID
+	Expires uint32
+	RQueue  uint32
+	WQueue  uint32
+	UID     uint32
+	Inode   uint32
+}
+
+func parseInetDiagMsg(b []byte) *InetDiagMsg {
+	return (*InetDiagMsg)(unsafe.Pointer(&b[0]))
+}
+
+// inetDiagAttribute returns the attribute of the given type of an inet_diag
+// message, or nil.
+func inetDiagAttribute(data []byte, typ uint16) ([]byte, error) {
+	if len(data) <= sizeOfInetDiagMsg {
+		return nil, nil
+	}
+	ad, err := netlink.NewAttributeDecoder(data[sizeOfInetDiagMsg:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid inet_diag attributes: %w", err)
+	}
+	for ad.Next() {
+		if ad.Type() == typ {
+			return ad.Bytes(), nil
+		}
+	}
+	return nil, ad.Err()
+}
+
+func (id *InetDiagSockID) sourcePort() uint16 {
+	return binary.BigEndian.Uint16(id.SourcePort[:])
+}
+
+func (id *InetDiagSockID) destPort() uint16 {
+	return binary.BigEndian.Uint16(id.DestPort[:])
+}
+
+func (id *InetDiagSockID) sourceIP(family uint8) net.IP {
+	return inetDiagIP(id.SourceIP, family)
+}
+
+func (id *InetDiagSockID) destIP(family uint8) net.IP {
+	return inetDiagIP(id.DestIP, family)
+}
+
+func inetDiagIP(words [4][4]byte, family uint8) net.IP {
+	ip := make(net.IP, 0, net.IPv6len)
+	for _, word := range words {
+		ip = append(ip, word[:]...)
+	}
+	if family == syscall.AF_INET {
+		return ip[:net.IPv4len]
+	}
+	return ip
+}
@@ -110,7 +110,11 @@ func (c *netDevCollector) metricDesc(key string) *prometheus.Desc {
 }
 
 func (c *netDevCollector) Update(ch chan<- prometheus.Metric) error {
-	netDev, err := getNetDevStats(&c.deviceFilter, c.logger)
+	return forEachNetNamespace(ch, c.logger, c.update)
+}
+
+func (c *netDevCollector) update(ch chan<- prometheus.Metric, ns netNamespace) error {
+	netDev, err := getNetDevStats(ns, &c.deviceFilter, c.logger)
 	if err != nil {
 		return fmt.Errorf("couldn't get netstats: %w", err)
 	}
@@ -23,18 +23,19 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/jsimonetti/rtnetlink"
-	"github.com/prometheus/procfs"
 )
 
 var (
 	netDevNetlink = kingpin.Flag("collector.netdev.netlink", "Use netlink to gather stats instead of /proc/net/dev.").Default("true").Bool()
 )
 
-func getNetDevStats(filter *deviceFilter, logger log.Logger) (netDevStats, error) {
+func getNetDevStats(ns netNamespace, filter *deviceFilter, logger log.Logger) (netDevStats, error) {
 	if *netDevNetlink {
+		// The netlink socket is created in the namespace of the calling
+		// thread.
 		return netlinkStats(filter, logger)
 	}
-	return procNetDevStats(filter, logger)
+	return procNetDevStats(ns, filter, logger)
 }
 
 func netlinkStats(filter *deviceFilter, logger log.Logger) (netDevStats, error) {
@@ -141,10 +142,10 @@ func parseNetlinkStats(links []rtnetlink.LinkMessage, filter *deviceFilter, logg
 	return metrics
 }
 
-func procNetDevStats(filter *deviceFilter, logger log.Logger) (netDevStats, error) {
+func procNetDevStats(ns netNamespace, filter *deviceFilter, logger log.Logger) (netDevStats, error) {
 	metrics := netDevStats{}
 
-	fs, err := procfs.NewFS(*procPath)
+	fs, err := ns.procFS()
 	if err != nil {
 		return metrics, fmt.Errorf("failed to open procfs: %w", err)
 	}
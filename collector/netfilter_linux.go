@@ -0,0 +1,352 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nonetfilter
+// +build !nonetfilter
+
+package collector
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/mdlayher/netlink"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// nf_tables messages and attributes of
+	// include/uapi/linux/netfilter/nf_tables.h.
+	nftMsgGetRule      = 7
+	nftMsgGetObj       = 19
+	nftaRuleTable      = 1
+	nftaRuleChain      = 2
+	nftaRuleHandle     = 3
+	nftaRuleExprs      = 4
+	nftaRuleUserdata   = 7
+	nftaListElem       = 1
+	nftaExprName       = 1
+	nftaExprData       = 2
+	nftaCounterBytes   = 1
+	nftaCounterPackets = 2
+	nftaObjTable       = 1
+	nftaObjName        = 2
+	nftaObjType        = 3
+	nftaObjData        = 4
+	nftaObjUserdata    = 8
+	nftObjectCounter   = 1
+
+	// NFTNL_UDATA_RULE_COMMENT and NFTNL_UDATA_OBJ_COMMENT, the type of the
+	// comment in the TLV encoded user data libnftnl stores with rules and
+	// objects.
+	nftUdataComment = 0
+)
+
+var (
+	netfilterTableInclude = kingpin.Flag("collector.netfilter.table-include", "Regexp of nftables tables to include (mutually exclusive to table-exclude).").String()
+	netfilterTableExclude = kingpin.Flag("collector.netfilter.table-exclude", "Regexp of nftables tables to exclude (mutually exclusive to table-include).").String()
+	netfilterChainInclude = kingpin.Flag("collector.netfilter.chain-include", "Regexp of nftables chains to include (mutually exclusive to chain-exclude).").String()
+	netfilterChainExclude = kingpin.Flag("collector.netfilter.chain-exclude", "Regexp of nftables chains to exclude (mutually exclusive to chain-include).").String()
+	netfilterFixtures     = kingpin.Flag("collector.netfilter.fixtures", "test fixtures to use for netfilter collector end-to-end testing").Default("").String()
+
+	// NFPROTO_* families as named by nft.
+	nftFamilies = map[uint8]string{
+		unix.NFPROTO_INET:   "inet",
+		unix.NFPROTO_IPV4:   "ip",
+		unix.NFPROTO_ARP:    "arp",
+		unix.NFPROTO_NETDEV: "netdev",
+		unix.NFPROTO_BRIDGE: "bridge",
+		unix.NFPROTO_IPV6:   "ip6",
+	}
+)
+
+type netfilterCollector struct {
+	tableFilter deviceFilter
+	chainFilter deviceFilter
+
+	rulePackets    typedDesc
+	ruleBytes      typedDesc
+	counterPackets typedDesc
+	counterBytes   typedDesc
+
+	logger log.Logger
+}
+
+func init() {
+	registerCollector("netfilter", defaultDisabled, NewNetfilterCollector)
+}
+
+// NewNetfilterCollector returns a new Collector exposing the nftables rule
+// and named counters.
+func NewNetfilterCollector(logger log.Logger) (Collector, error) {
+	desc := func(name, help string, labels ...string) typedDesc {
+		return typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "netfilter", name),
+			help, labels, nil,
+		), prometheus.CounterValue}
+	}
+	ruleLabels := []string{"family", "table", "chain", "handle", "comment"}
+	counterLabels := []string{"family", "table", "name", "comment"}
+	return &netfilterCollector{
+		tableFilter: newDeviceFilter(*netfilterTableExclude, *netfilterTableInclude),
+		chainFilter: newDeviceFilter(*netfilterChainExclude, *netfilterChainInclude),
+
+		rulePackets:    desc("rule_packets_total", "Packets matched by the counter of the nftables rule.", ruleLabels...),
+		ruleBytes:      desc("rule_bytes_total", "Bytes matched by the counter of the nftables rule.", ruleLabels...),
+		counterPackets: desc("counter_packets_total", "Packets counted by the named nftables counter.", counterLabels...),
+		counterBytes:   desc("counter_bytes_total", "Bytes counted by the named nftables counter.", counterLabels...),
+
+		logger: logger,
+	}, nil
+}
+
+// nftRule is an nftables rule with counter expressions.
+type nftRule struct {
+	family  string
+	table   string
+	chain   string
+	handle  uint64
+	comment string
+	packets uint64
+	bytes   uint64
+}
+
+// nftCounter is a named nftables counter.
+type nftCounter struct {
+	family  string
+	table   string
+	name    string
+	comment string
+	packets uint64
+	bytes   uint64
+}
+
+func (c *netfilterCollector) Update(ch chan<- prometheus.Metric) error {
+	ruleMsgs, objMsgs, err := getNftMessages(*netfilterFixtures)
+	if err != nil {
+		return err
+	}
+
+	rules, err := parseNftRules(ruleMsgs)
+	if err != nil {
+		return fmt.Errorf("couldn't parse nftables rules: %w", err)
+	}
+	for _, r := range rules {
+		if c.tableFilter.ignored(r.table) || c.chainFilter.ignored(r.chain) {
+			continue
+		}
+		handle := strconv.FormatUint(r.handle, 10)
+		ch <- c.rulePackets.mustNewConstMetric(float64(r.packets), r.family, r.table, r.chain, handle, r.comment)
+		ch <- c.ruleBytes.mustNewConstMetric(float64(r.bytes), r.family, r.table, r.chain, handle, r.comment)
+	}
+
+	counters, err := parseNftCounters(objMsgs)
+	if err != nil {
+		return fmt.Errorf("couldn't parse nftables counters: %w", err)
+	}
+	for _, o := range counters {
+		if c.tableFilter.ignored(o.table) {
+			continue
+		}
+		ch <- c.counterPackets.mustNewConstMetric(float64(o.packets), o.family, o.table, o.name, o.comment)
+		ch <- c.counterBytes.mustNewConstMetric(float64(o.bytes), o.family, o.table, o.name, o.comment)
+	}
+
+	return nil
+}
+
+// getNftMessages dumps the rules and objects of all tables, or reads the
+// dumps from the fixtures directory.
+func getNftMessages(fixtures string) (rules, objects []netlink.Message, err error) {
+	if fixtures != "" {
+		if rules, err = readNetlinkMessages(filepath.Join(fixtures, "rules")); err != nil {
+			return nil, nil, err
+		}
+		if objects, err = readNetlinkMessages(filepath.Join(fixtures, "objects")); err != nil {
+			return nil, nil, err
+		}
+		return rules, objects, nil
+	}
+
+	conn, err := netlink.Dial(unix.NETLINK_NETFILTER, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	if rules, err = nfnetlinkDump(conn, unix.NFNL_SUBSYS_NFTABLES, nftMsgGetRule); err != nil {
+		return nil, nil, fmt.Errorf("couldn't dump nftables rules: %w", err)
+	}
+	if objects, err = nfnetlinkDump(conn, unix.NFNL_SUBSYS_NFTABLES, nftMsgGetObj); err != nil {
+		return nil, nil, fmt.Errorf("couldn't dump nftables objects: %w", err)
+	}
+	return rules, objects, nil
+}
+
+// nftAttributes returns the family and a decoder of the attributes of an
+// nfnetlink message, which are in network byte order.
+func nftAttributes(m netlink.Message) (string, *netlink.AttributeDecoder, error) {
+	ad, err := nfnetlinkAttributes(m)
+	if err != nil {
+		return "", nil, err
+	}
+	family, ok := nftFamilies[m.Data[0]]
+	if !ok {
+		family = strconv.Itoa(int(m.Data[0]))
+	}
+	return family, ad, nil
+}
+
+// parseNftRules returns the rules with counter expressions, with the counts
+// of all their counters added up.
+func parseNftRules(msgs []netlink.Message) ([]nftRule, error) {
+	var rules []nftRule
+
+	for _, m := range msgs {
+		family, ad, err := nftAttributes(m)
+		if err != nil {
+			return nil, err
+		}
+		rule := nftRule{family: family}
+		hasCounter := false
+		for ad.Next() {
+			switch ad.Type() {
+			case nftaRuleTable:
+				rule.table = ad.String()
+			case nftaRuleChain:
+				rule.chain = ad.String()
+			case nftaRuleHandle:
+				rule.handle = ad.Uint64()
+			case nftaRuleUserdata:
+				rule.comment = nftComment(ad.Bytes())
+			case nftaRuleExprs:
+				ad.Nested(func(lad *netlink.AttributeDecoder) error {
+					for lad.Next() {
+						if lad.Type() != nftaListElem {
+							continue
+						}
+						lad.Nested(func(ead *netlink.AttributeDecoder) error {
+							ok, err := parseNftCounterExpr(ead, &rule.packets, &rule.bytes)
+							hasCounter = hasCounter || ok
+							return err
+						})
+					}
+					return lad.Err()
+				})
+			}
+		}
+		if err := ad.Err(); err != nil {
+			return nil, err
+		}
+		if hasCounter {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
+
+// parseNftCounterExpr adds the counts of a counter expression, and reports
+// whether the expression is one.
+func parseNftCounterExpr(ad *netlink.AttributeDecoder, packets, bytes *uint64) (bool, error) {
+	isCounter := false
+	for ad.Next() {
+		switch ad.Type() {
+		case nftaExprName:
+			isCounter = ad.String() == "counter"
+		case nftaExprData:
+			// The name precedes the data.
+			if isCounter {
+				ad.Nested(func(cad *netlink.AttributeDecoder) error {
+					return parseNftCounterData(cad, packets, bytes)
+				})
+			}
+		}
+	}
+	return isCounter, ad.Err()
+}
+
+func parseNftCounterData(ad *netlink.AttributeDecoder, packets, bytes *uint64) error {
+	for ad.Next() {
+		switch ad.Type() {
+		case nftaCounterPackets:
+			*packets += ad.Uint64()
+		case nftaCounterBytes:
+			*bytes += ad.Uint64()
+		}
+	}
+	return ad.Err()
+}
+
+// parseNftCounters returns the named counters among the objects.
+func parseNftCounters(msgs []netlink.Message) ([]nftCounter, error) {
+	var counters []nftCounter
+
+	for _, m := range msgs {
+		family, ad, err := nftAttributes(m)
+		if err != nil {
+			return nil, err
+		}
+		counter := nftCounter{family: family}
+		var objType uint32
+		for ad.Next() {
+			switch ad.Type() {
+			case nftaObjTable:
+				counter.table = ad.String()
+			case nftaObjName:
+				counter.name = ad.String()
+			case nftaObjType:
+				objType = ad.Uint32()
+			case nftaObjUserdata:
+				counter.comment = nftComment(ad.Bytes())
+			case nftaObjData:
+				// The kernel sends the type first, the data of other
+				// object types such as quotas has different attributes.
+				if objType == nftObjectCounter {
+					ad.Nested(func(cad *netlink.AttributeDecoder) error {
+						return parseNftCounterData(cad, &counter.packets, &counter.bytes)
+					})
+				}
+			}
+		}
+		if err := ad.Err(); err != nil {
+			return nil, err
+		}
+		if objType == nftObjectCounter {
+			counters = append(counters, counter)
+		}
+	}
+
+	return counters, nil
+}
+
+// nftComment returns the comment in the user data of a rule or object: type
+// and length bytes followed by a NUL terminated value, for each item.
+func nftComment(b []byte) string {
+	for len(b) >= 2 {
+		typ, length := b[0], int(b[1])
+		if len(b) < 2+length {
+			break
+		}
+		if typ == nftUdataComment {
+			return strings.TrimRight(string(b[2:2+length]), "\x00")
+		}
+		b = b[2+length:]
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nonetfilter
+// +build !nonetfilter
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNftRules(t *testing.T) {
+	msgs, err := readNetlinkMessages("fixtures/netfilter/rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := parseNftRules(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rules were inserted at the start of the chains. The rule
+	// referencing a named counter and the one without counter are left out.
+	want := []nftRule{
+		{family: "inet", table: "filter", chain: "input", handle: 6, packets: 10, bytes: 1500},
+		{family: "inet", table: "filter", chain: "input", handle: 5, comment: "drop invalid", packets: 64, bytes: 4096},
+		{family: "inet", table: "filter", chain: "forward", handle: 9, comment: "forward drops"},
+		{family: "ip", table: "mangle", chain: "prerouting", handle: 2, packets: 98765, bytes: 123456789},
+	}
+	if !reflect.DeepEqual(want, rules) {
+		t.Errorf("want rules\n%+v\ngot\n%+v", want, rules)
+	}
+}
+
+func TestParseNftCounters(t *testing.T) {
+	// The objects also include a quota, which is not a counter.
+	msgs, err := readNetlinkMessages("fixtures/netfilter/objects")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counters, err := parseNftCounters(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []nftCounter{
+		{family: "inet", table: "filter", name: "ssh_attempts", comment: "SSH connection attempts", packets: 512, bytes: 30720},
+		{family: "inet", table: "filter", name: "http", packets: 2048, bytes: 1048576},
+	}
+	if !reflect.DeepEqual(want, counters) {
+		t.Errorf("want counters\n%+v\ngot\n%+v", want, counters)
+	}
+}
+
+func TestNftComment(t *testing.T) {
+	for _, tc := range []struct {
+		userdata []byte
+		want     string
+	}{
+		{nil, ""},
+		{[]byte{0, 4, 'f', 'o', 'o', 0}, "foo"},
+		// A comment after another item.
+		{[]byte{1, 1, 0, 0, 4, 'b', 'a', 'r', 0}, "bar"},
+		// Truncated.
+		{[]byte{0, 8, 'b', 'a', 'z'}, ""},
+	} {
+		if got := nftComment(tc.userdata); got != tc.want {
+			t.Errorf("nftComment(%v) = %q, want %q", tc.userdata, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/procfs"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	netnsLabel = "netns"
+
+	// The network namespaces are listed at most once in this interval. All
+	// netns aware collectors of a scrape, which run concurrently, share a
+	// single listing of /run/netns and the processes.
+	netnsCacheTTL = 5 * time.Second
+)
+
+var (
+	netnsEnable  = kingpin.Flag("collector.netns.enable", "Also collect the conntrack, netdev, netstat, sockdiag, sockstat and tcpstat metrics of the other network namespaces, with a netns label.").Bool()
+	netnsInclude = kingpin.Flag("collector.netns.include", "Regexp of network namespaces to collect.").Default("").String()
+	netnsExclude = kingpin.Flag("collector.netns.exclude", "Regexp of network namespaces not to collect.").Default("").String()
+
+	netnsFilterOnce sync.Once
+	netnsFilter     deviceFilter
+
+	netnsCache struct {
+		sync.Mutex
+		namespaces []netNamespace
+		listed     time.Time
+	}
+)
+
+// netNamespace is a network namespace metrics are collected in. The zero
+// value is the namespace of the exporter itself.
+type netNamespace struct {
+	// Name of the namespace: the file name below /run/netns for namespaces
+	// created by "ip netns", otherwise "net:[<inode>]" as shown by
+	// readlink /proc/<pid>/ns/net.
+	name string
+	path string
+}
+
+// procFilePath returns the path of a per namespace file below /proc/net for
+// the namespace the calling thread is in.
+func (ns netNamespace) procFilePath(name string) string {
+	if ns.path == "" {
+		return procFilePath(name)
+	}
+	// /proc/net is a link to /proc/self/net, which shows the namespace of
+	// the main thread.
+	return procFilePath(filepath.Join("thread-self", name))
+}
+
+// procFS returns a procfs.FS reading per namespace files, such as
+// /proc/net/dev, of the namespace the calling thread is in.
+func (ns netNamespace) procFS() (procfs.FS, error) {
+	return procfs.NewFS(ns.procFilePath(""))
+}
+
+// run calls f on a thread in the namespace.
+func (ns netNamespace) run(f func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		// The thread is never unlocked, so the runtime terminates it with the
+		// goroutine instead of reusing it in the wrong namespace.
+		runtime.LockOSThread()
+		fd, err := unix.Open(ns.path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer unix.Close(fd)
+		if err := unix.Setns(fd, unix.CLONE_NEWNET); err != nil {
+			errc <- fmt.Errorf("couldn't enter network namespace: %w", err)
+			return
+		}
+		errc <- f()
+	}()
+	return <-errc
+}
+
+// forEachNetNamespace calls update for the namespace of the exporter and, if
+// enabled, in each other network namespace. The metrics of other namespaces
+// get a netns label. Failures in other namespaces, which may disappear at
+// any time, are only logged.
+func forEachNetNamespace(ch chan<- prometheus.Metric, logger log.Logger, update func(chan<- prometheus.Metric, netNamespace) error) error {
+	if err := update(ch, netNamespace{}); err != nil {
+		return err
+	}
+	if !*netnsEnable {
+		return nil
+	}
+
+	namespaces, err := netNamespaces(logger)
+	if err != nil {
+		return fmt.Errorf("couldn't list network namespaces: %w", err)
+	}
+	for _, ns := range namespaces {
+		labelled := make(chan prometheus.Metric)
+		done := make(chan struct{})
+		go func(name string) {
+			for m := range labelled {
+				ch <- netnsMetric{Metric: m, netns: name}
+			}
+			close(done)
+		}(ns.name)
+		err := ns.run(func() error { return update(labelled, ns) })
+		close(labelled)
+		<-done
+		if err != nil && !errors.Is(err, ErrNoData) {
+			level.Debug(logger).Log("msg", "couldn't collect network namespace", "netns", ns.name, "err", err)
+		}
+	}
+	return nil
+}
+
+// netNamespaces returns the network namespaces other than the one of the
+// exporter, listed at most netnsCacheTTL ago. Callers must not modify the
+// result.
+func netNamespaces(logger log.Logger) ([]netNamespace, error) {
+	netnsCache.Lock()
+	defer netnsCache.Unlock()
+
+	if !netnsCache.listed.IsZero() && time.Since(netnsCache.listed) < netnsCacheTTL {
+		return netnsCache.namespaces, nil
+	}
+	namespaces, err := listNetNamespaces(logger)
+	if err != nil {
+		return nil, err
+	}
+	netnsCache.namespaces = namespaces
+	netnsCache.listed = time.Now()
+	return namespaces, nil
+}
+
+// listNetNamespaces lists the network namespaces other than the one of the
+// exporter: those named by "ip netns" and those of processes.
+func listNetNamespaces(logger log.Logger) ([]netNamespace, error) {
+	netnsFilterOnce.Do(func() {
+		netnsFilter = newDeviceFilter(*netnsExclude, *netnsInclude)
+	})
+
+	self, err := netNamespaceInode(procFilePath("self/ns/net"))
+	if err != nil {
+		return nil, err
+	}
+	seen := map[uint64]bool{self: true}
+	var namespaces []netNamespace
+	add := func(name, path string) {
+		inode, err := netNamespaceInode(path)
+		if err != nil {
+			// The namespace or process is gone, or not accessible.
+			level.Debug(logger).Log("msg", "couldn't stat network namespace", "path", path, "err", err)
+			return
+		}
+		if seen[inode] {
+			return
+		}
+		seen[inode] = true
+		if name == "" {
+			name = fmt.Sprintf("net:[%d]", inode)
+		}
+		if netnsFilter.ignored(name) {
+			return
+		}
+		namespaces = append(namespaces, netNamespace{name: name, path: path})
+	}
+
+	// Named namespaces come first, so that they are labelled by name.
+	runDir := rootfsFilePath("/run/netns")
+	named, err := os.ReadDir(runDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range named {
+		add(e.Name(), filepath.Join(runDir, e.Name()))
+	}
+
+	procs, err := os.ReadDir(procFilePath(""))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range procs {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		add("", procFilePath(filepath.Join(e.Name(), "ns/net")))
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].name < namespaces[j].name })
+	return namespaces, nil
+}
+
+func netNamespaceInode(path string) (uint64, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0, err
+	}
+	return st.Ino, nil
+}
+
+// netnsMetric adds the netns label to a metric of another network namespace.
+type netnsMetric struct {
+	prometheus.Metric
+	netns string
+}
+
+func (m netnsMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+	name := netnsLabel
+	out.Label = append(out.Label, &dto.LabelPair{Name: &name, Value: &m.netns})
+	sort.Slice(out.Label, func(i, j int) bool { return out.Label[i].GetName() < out.Label[j].GetName() })
+	return nil
+}
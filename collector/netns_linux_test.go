@@ -0,0 +1,88 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type testNetnsCollector struct {
+	metrics []prometheus.Metric
+}
+
+func (c testNetnsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c.metrics {
+		ch <- m
+	}
+}
+
+func (c testNetnsCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+func TestNetnsMetric(t *testing.T) {
+	desc := prometheus.NewDesc("node_network_receive_bytes_total", "Network device statistic receive_bytes.", []string{"device"}, nil)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(testNetnsCollector{metrics: []prometheus.Metric{
+		prometheus.MustNewConstMetric(desc, prometheus.CounterValue, 100, "eth0"),
+		netnsMetric{prometheus.MustNewConstMetric(desc, prometheus.CounterValue, 200, "eth0"), "blue"},
+		netnsMetric{prometheus.MustNewConstMetric(desc, prometheus.CounterValue, 300, "eth0"), "net:[4026532281]"},
+	}})
+	expected := `# HELP node_network_receive_bytes_total Network device statistic receive_bytes.
+# TYPE node_network_receive_bytes_total counter
+node_network_receive_bytes_total{device="eth0"} 100
+node_network_receive_bytes_total{device="eth0",netns="blue"} 200
+node_network_receive_bytes_total{device="eth0",netns="net:[4026532281]"} 300
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNetNamespaceProcFilePath(t *testing.T) {
+	defer func(old string) { *procPath = old }(*procPath)
+	*procPath = "/proc"
+
+	if got := (netNamespace{}).procFilePath("net/dev"); got != "/proc/net/dev" {
+		t.Errorf("expected /proc/net/dev for the own namespace, got %s", got)
+	}
+	ns := netNamespace{name: "blue", path: "/run/netns/blue"}
+	if got := ns.procFilePath("net/dev"); got != "/proc/thread-self/net/dev" {
+		t.Errorf("expected /proc/thread-self/net/dev for another namespace, got %s", got)
+	}
+}
+
+func TestNetNamespacesCache(t *testing.T) {
+	defer func(old string) { *procPath = old }(*procPath)
+	*procPath = "/proc"
+	defer func() { netnsCache.listed = time.Time{} }()
+
+	if _, err := netNamespaces(log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	// Within the TTL the namespaces are not listed again.
+	*procPath = t.TempDir()
+	if _, err := netNamespaces(log.NewNopLogger()); err != nil {
+		t.Errorf("expected cached namespaces, got %v", err)
+	}
+	netnsCache.listed = time.Now().Add(-netnsCacheTTL)
+	if _, err := netNamespaces(log.NewNopLogger()); err == nil {
+		t.Error("expected namespaces to be listed again after the TTL")
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package collector
+
+import (
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// netNamespace is a network namespace, which only exist on Linux.
+type netNamespace struct{}
+
+// forEachNetNamespace calls update for the network stack of the host.
+func forEachNetNamespace(ch chan<- prometheus.Metric, _ log.Logger, update func(chan<- prometheus.Metric, netNamespace) error) error {
+	return update(ch, netNamespace{})
+}
@@ -59,15 +59,19 @@ func NewNetStatCollector(logger log.Logger) (Collector, error) {
 }
 
 func (c *netStatCollector) Update(ch chan<- prometheus.Metric) error {
-	netStats, err := getNetStats(procFilePath("net/netstat"))
+	return forEachNetNamespace(ch, c.logger, c.update)
+}
+
+func (c *netStatCollector) update(ch chan<- prometheus.Metric, ns netNamespace) error {
+	netStats, err := getNetStats(ns.procFilePath("net/netstat"))
 	if err != nil {
 		return fmt.Errorf("couldn't get netstats: %w", err)
 	}
-	snmpStats, err := getNetStats(procFilePath("net/snmp"))
+	snmpStats, err := getNetStats(ns.procFilePath("net/snmp"))
 	if err != nil {
 		return fmt.Errorf("couldn't get SNMP stats: %w", err)
 	}
-	snmp6Stats, err := getSNMP6Stats(procFilePath("net/snmp6"))
+	snmp6Stats, err := getSNMP6Stats(ns.procFilePath("net/snmp6"))
 	if err != nil {
 		return fmt.Errorf("couldn't get SNMP6 stats: %w", err)
 	}
@@ -18,19 +18,41 @@ package collector
 
 import (
 	"fmt"
-	"golang.org/x/sys/unix"
 	"net"
 	"strconv"
+	"strings"
 
 	"github.com/go-kit/log"
 	"github.com/jsimonetti/rtnetlink"
 	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Rule actions of include/uapi/linux/fib_rules.h.
+	frActToTbl       = 1
+	frActGoto        = 2
+	frActNop         = 3
+	frActBlackhole   = 6
+	frActUnreachable = 7
+	frActProhibit    = 8
+	fibRuleInvert    = 0x2
 )
 
 type networkRouteCollector struct {
-	routeInfoDesc *prometheus.Desc
-	routesDesc    *prometheus.Desc
-	logger        log.Logger
+	routeInfoDesc         *prometheus.Desc
+	routesDesc            *prometheus.Desc
+	tableRoutesDesc       *prometheus.Desc
+	tableDefaultRouteDesc *prometheus.Desc
+	nextHopWeightDesc     *prometheus.Desc
+	ruleInfoDesc          *prometheus.Desc
+	logger                log.Logger
+}
+
+// networkRouteTable is a routing table of an address family.
+type networkRouteTable struct {
+	ip    string
+	table string
 }
 
 func init() {
@@ -43,17 +65,37 @@ func NewNetworkRouteCollector(logger log.Logger) (Collector, error) {
 
 	routeInfoDesc := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, subsystem, "route_info"),
-		"network routing table information", []string{"device", "src", "dest", "gw", "priority", "proto", "weight"}, nil,
+		"network routing table information", []string{"device", "src", "dest", "gw", "priority", "proto", "weight", "table"}, nil,
 	)
 	routesDesc := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, subsystem, "routes"),
 		"network routes by interface", []string{"device"}, nil,
 	)
+	tableRoutesDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "route_table_routes"),
+		"network routes of all types by routing table and protocol", []string{"ip", "table", "proto"}, nil,
+	)
+	tableDefaultRouteDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "route_table_default_route"),
+		"whether the routing table has a unicast default route", []string{"ip", "table"}, nil,
+	)
+	nextHopWeightDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "route_nexthop_weight"),
+		"weight of the next hop of a multipath route", []string{"ip", "table", "dest", "priority", "device", "gw"}, nil,
+	)
+	ruleInfoDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "route_rule_info"),
+		"policy routing rule information", []string{"ip", "priority", "selector", "action", "table"}, nil,
+	)
 
 	return &networkRouteCollector{
-		routeInfoDesc: routeInfoDesc,
-		routesDesc:    routesDesc,
-		logger:        logger,
+		routeInfoDesc:         routeInfoDesc,
+		routesDesc:            routesDesc,
+		tableRoutesDesc:       tableRoutesDesc,
+		tableDefaultRouteDesc: tableDefaultRouteDesc,
+		nextHopWeightDesc:     nextHopWeightDesc,
+		ruleInfoDesc:          ruleInfoDesc,
+		logger:                logger,
 	}, nil
 }
 
@@ -76,10 +118,29 @@ func (n networkRouteCollector) Update(ch chan<- prometheus.Metric) error {
 		return fmt.Errorf("couldn't get routes: %w", err)
 	}
 
+	tableRoutes := make(map[networkRouteTable]map[string]int)
+	tableDefaultRoute := make(map[networkRouteTable]bool)
+
 	for _, route := range routes {
-		if route.Type != unix.RTA_DST {
+		ip, isIP := networkRouteFamilyToString(route.Family)
+		tableID := route.Attributes.Table
+		if tableID == 0 {
+			tableID = uint32(route.Table)
+		}
+		table := networkRouteTable{ip: ip, table: networkRouteTableToString(tableID)}
+		if isIP {
+			if tableRoutes[table] == nil {
+				tableRoutes[table] = make(map[string]int)
+			}
+			tableRoutes[table][networkRouteProtocolToString(route.Protocol)]++
+		}
+		if route.Type != unix.RTN_UNICAST {
 			continue
 		}
+		if isIP {
+			tableDefaultRoute[table] = tableDefaultRoute[table] || route.DstLength == 0
+		}
+
 		if len(route.Attributes.Multipath) != 0 {
 			for _, nextHop := range route.Attributes.Multipath {
 				ifName := ""
@@ -98,8 +159,13 @@ func (n networkRouteCollector) Update(ch chan<- prometheus.Metric) error {
 					strconv.FormatUint(uint64(route.Attributes.Priority), 10),               // priority(metrics)
 					networkRouteProtocolToString(route.Protocol),                            // proto
 					strconv.Itoa(int(nextHop.Hop.Hops) + 1),                                 // weight
+					table.table,                                                             // table
 				}
 				ch <- prometheus.MustNewConstMetric(n.routeInfoDesc, prometheus.GaugeValue, 1, labels...)
+				// rtnh_hops holds the weight minus one.
+				dest, gw, priority := labels[2], labels[3], labels[4]
+				ch <- prometheus.MustNewConstMetric(n.nextHopWeightDesc, prometheus.GaugeValue, float64(nextHop.Hop.Hops)+1,
+					ip, table.table, dest, priority, ifName, gw)
 				deviceRoutes[ifName]++
 			}
 		} else {
@@ -118,7 +184,8 @@ func (n networkRouteCollector) Update(ch chan<- prometheus.Metric) error {
 				networkRouteIPToString(route.Attributes.Gateway),                        // gw
 				strconv.FormatUint(uint64(route.Attributes.Priority), 10),               // priority(metrics)
 				networkRouteProtocolToString(route.Protocol),                            // proto
-				"", // weight
+				"",          // weight
+				table.table, // table
 			}
 			ch <- prometheus.MustNewConstMetric(n.routeInfoDesc, prometheus.GaugeValue, 1, labels...)
 			deviceRoutes[ifName]++
@@ -128,10 +195,197 @@ func (n networkRouteCollector) Update(ch chan<- prometheus.Metric) error {
 	for dev, total := range deviceRoutes {
 		ch <- prometheus.MustNewConstMetric(n.routesDesc, prometheus.GaugeValue, float64(total), dev)
 	}
+	for table, protocols := range tableRoutes {
+		for proto, total := range protocols {
+			ch <- prometheus.MustNewConstMetric(n.tableRoutesDesc, prometheus.GaugeValue, float64(total), table.ip, table.table, proto)
+		}
+		ch <- prometheus.MustNewConstMetric(n.tableDefaultRouteDesc, prometheus.GaugeValue, boolToFloat(tableDefaultRoute[table]), table.ip, table.table)
+	}
+
+	rules, err := conn.Rule.List()
+	if err != nil {
+		return fmt.Errorf("couldn't get rules: %w", err)
+	}
+	for _, labels := range networkRouteRuleLabels(rules) {
+		ch <- prometheus.MustNewConstMetric(n.ruleInfoDesc, prometheus.GaugeValue, 1, labels...)
+	}
 
 	return nil
 }
 
+// networkRouteRuleLabels returns the labels of the IPv4 and IPv6 rules, in the
+// form ip rule shows them. Rules only differing in attributes not shown are
+// merged.
+func networkRouteRuleLabels(rules []rtnetlink.RuleMessage) [][]string {
+	var res [][]string
+	seen := make(map[string]bool)
+
+	for _, rule := range rules {
+		ip, ok := networkRouteFamilyToString(rule.Family)
+		if !ok {
+			continue
+		}
+		attrs := rule.Attributes
+		if attrs == nil {
+			attrs = &rtnetlink.RuleAttributes{}
+		}
+
+		var priority uint32
+		if attrs.Priority != nil {
+			priority = *attrs.Priority
+		}
+		table := ""
+		if rule.Action == frActToTbl {
+			tableID := uint32(rule.Table)
+			if attrs.Table != nil {
+				tableID = *attrs.Table
+			}
+			table = networkRouteTableToString(tableID)
+		}
+
+		labels := []string{
+			ip,
+			strconv.FormatUint(uint64(priority), 10),
+			networkRouteRuleSelector(rule, attrs),
+			networkRouteRuleActionToString(rule.Action),
+			table,
+		}
+		key := strings.Join(labels, "\x00")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		res = append(res, labels)
+	}
+
+	return res
+}
+
+// networkRouteRuleSelector returns the selector of a rule as shown by ip rule,
+// such as "from 10.0.0.0/8 fwmark 0x1/0xff".
+func networkRouteRuleSelector(rule rtnetlink.RuleMessage, attrs *rtnetlink.RuleAttributes) string {
+	var sel []string
+	if rule.Flags&fibRuleInvert != 0 {
+		sel = append(sel, "not")
+	}
+	prefix := func(ip *net.IP, length uint8) string {
+		if ip == nil || length == 0 {
+			return "all"
+		}
+		if int(length) == len(*ip)*8 || (ip.To4() != nil && length == 32) {
+			return ip.String()
+		}
+		return networkRouteIPWithPrefixToString(*ip, length)
+	}
+	sel = append(sel, "from", prefix(attrs.Src, rule.SrcLength))
+	if attrs.Dst != nil && rule.DstLength != 0 {
+		sel = append(sel, "to", prefix(attrs.Dst, rule.DstLength))
+	}
+	if rule.TOS != 0 {
+		sel = append(sel, "tos", fmt.Sprintf("0x%x", rule.TOS))
+	}
+	if attrs.FwMark != nil || attrs.FwMask != nil {
+		var mark, mask uint32 = 0, 0xffffffff
+		if attrs.FwMark != nil {
+			mark = *attrs.FwMark
+		}
+		if attrs.FwMask != nil {
+			mask = *attrs.FwMask
+		}
+		if mask == 0xffffffff {
+			sel = append(sel, "fwmark", fmt.Sprintf("0x%x", mark))
+		} else {
+			sel = append(sel, "fwmark", fmt.Sprintf("0x%x/0x%x", mark, mask))
+		}
+	}
+	if attrs.IIFName != nil {
+		sel = append(sel, "iif", *attrs.IIFName)
+	}
+	if attrs.OIFName != nil {
+		sel = append(sel, "oif", *attrs.OIFName)
+	}
+	if attrs.L3MDev != nil && *attrs.L3MDev != 0 {
+		sel = append(sel, "l3mdev")
+	}
+	// The uidrange is left out, rtnetlink decodes the 32 bit UIDs as 16 bit.
+	if attrs.IPProto != nil {
+		sel = append(sel, "ipproto", networkRouteIPProtoToString(*attrs.IPProto))
+	}
+	portRange := func(r *rtnetlink.RulePortRange) string {
+		if r.Start == r.End {
+			return strconv.Itoa(int(r.Start))
+		}
+		return fmt.Sprintf("%d-%d", r.Start, r.End)
+	}
+	if attrs.SPortRange != nil {
+		sel = append(sel, "sport", portRange(attrs.SPortRange))
+	}
+	if attrs.DPortRange != nil {
+		sel = append(sel, "dport", portRange(attrs.DPortRange))
+	}
+	return strings.Join(sel, " ")
+}
+
+// networkRouteIPProtoToString returns the name of the protocol as in
+// /etc/protocols, or its number.
+func networkRouteIPProtoToString(proto uint8) string {
+	switch proto {
+	case unix.IPPROTO_ICMP:
+		return "icmp"
+	case unix.IPPROTO_TCP:
+		return "tcp"
+	case unix.IPPROTO_UDP:
+		return "udp"
+	case unix.IPPROTO_ICMPV6:
+		return "ipv6-icmp"
+	case unix.IPPROTO_SCTP:
+		return "sctp"
+	}
+	return strconv.Itoa(int(proto))
+}
+
+func networkRouteRuleActionToString(action uint8) string {
+	switch action {
+	case frActToTbl:
+		return "lookup"
+	case frActGoto:
+		return "goto"
+	case frActNop:
+		return "nop"
+	case frActBlackhole:
+		return "blackhole"
+	case frActUnreachable:
+		return "unreachable"
+	case frActProhibit:
+		return "prohibit"
+	}
+	return "unknown"
+}
+
+func networkRouteFamilyToString(family uint8) (string, bool) {
+	switch family {
+	case unix.AF_INET:
+		return "v4", true
+	case unix.AF_INET6:
+		return "v6", true
+	}
+	return "", false
+}
+
+// networkRouteTableToString returns the name of the table as in
+// /etc/iproute2/rt_tables, or its number.
+func networkRouteTableToString(table uint32) string {
+	switch table {
+	case unix.RT_TABLE_DEFAULT:
+		return "default"
+	case unix.RT_TABLE_MAIN:
+		return "main"
+	case unix.RT_TABLE_LOCAL:
+		return "local"
+	}
+	return strconv.FormatUint(uint64(table), 10)
+}
+
 func networkRouteIPWithPrefixToString(ip net.IP, len uint8) string {
 	if len == 0 {
 		return "default"
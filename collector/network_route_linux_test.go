@@ -0,0 +1,66 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nonetworkroute
+// +build !nonetworkroute
+
+package collector
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/jsimonetti/rtnetlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestNetworkRouteRuleLabels(t *testing.T) {
+	u32 := func(v uint32) *uint32 { return &v }
+	u8 := func(v uint8) *uint8 { return &v }
+	str := func(v string) *string { return &v }
+	ip := func(s string) *net.IP { v := net.ParseIP(s); return &v }
+
+	rules := []rtnetlink.RuleMessage{
+		{Family: unix.AF_INET, Table: unix.RT_TABLE_LOCAL, Action: frActToTbl, Attributes: &rtnetlink.RuleAttributes{
+			Priority: u32(0), Table: u32(unix.RT_TABLE_LOCAL),
+		}},
+		{Family: unix.AF_INET, SrcLength: 8, Action: frActToTbl, Attributes: &rtnetlink.RuleAttributes{
+			Priority: u32(100), Src: ip("10.0.0.0"), FwMark: u32(1), FwMask: u32(0xff), Table: u32(1000),
+		}},
+		// Differs from the previous rule only in attributes not shown.
+		{Family: unix.AF_INET, SrcLength: 8, Action: frActToTbl, Attributes: &rtnetlink.RuleAttributes{
+			Priority: u32(100), Src: ip("10.0.0.0"), FwMark: u32(1), FwMask: u32(0xff), Table: u32(1000), SuppressPrefixLen: u32(0),
+		}},
+		{Family: unix.AF_INET, DstLength: 32, Flags: fibRuleInvert, Action: frActProhibit, Attributes: &rtnetlink.RuleAttributes{
+			Priority: u32(200), Dst: ip("192.0.2.7"), IPProto: u8(unix.IPPROTO_TCP), DPortRange: &rtnetlink.RulePortRange{Start: 80, End: 90},
+		}},
+		{Family: unix.AF_INET6, Action: frActGoto, Attributes: &rtnetlink.RuleAttributes{
+			Priority: u32(300), IIFName: str("eth0"), Goto: u32(32766),
+		}},
+		// An IPv4 multicast routing rule, of family RTNL_FAMILY_IPMR.
+		{Family: 128, Action: frActToTbl, Attributes: &rtnetlink.RuleAttributes{
+			Priority: u32(32767), Table: u32(unix.RT_TABLE_DEFAULT),
+		}},
+	}
+
+	want := [][]string{
+		{"v4", "0", "from all", "lookup", "local"},
+		{"v4", "100", "from 10.0.0.0/8 fwmark 0x1/0xff", "lookup", "1000"},
+		{"v4", "200", "not from all to 192.0.2.7 ipproto tcp dport 80-90", "prohibit", ""},
+		{"v6", "300", "from all iif eth0", "goto", ""},
+	}
+	if got := networkRouteRuleLabels(rules); !reflect.DeepEqual(want, got) {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
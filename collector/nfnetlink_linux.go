@@ -0,0 +1,160 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/josharian/native"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// struct nfgenmsg precedes the attributes of nfnetlink messages.
+const sizeOfNfgenmsg = 4
+
+// nfnetlinkDump dumps the objects of a message type of an nfnetlink
+// subsystem, of all families.
+func nfnetlinkDump(conn *netlink.Conn, subsys, msgType uint16) ([]netlink.Message, error) {
+	return conn.Execute(nfnetlinkDumpRequest(subsys, msgType))
+}
+
+// nfnetlinkDumpFunc dumps like nfnetlinkDump, but calls fn for each object
+// as the datagrams arrive instead of buffering the whole dump, which may be
+// large. Conn.Receive drains all parts of a dump, so the datagrams are read
+// from the socket directly.
+func nfnetlinkDumpFunc(conn *netlink.Conn, subsys, msgType uint16, fn func(netlink.Message) error) error {
+	req, err := conn.Send(nfnetlinkDumpRequest(subsys, msgType))
+	if err != nil {
+		return err
+	}
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, os.Getpagesize())
+	for {
+		var n int
+		var rerr error
+		err := rc.Read(func(fd uintptr) bool {
+			// Peek at the size first, a dump datagram may be larger than
+			// a page.
+			n, _, rerr = unix.Recvfrom(int(fd), buf, unix.MSG_PEEK|unix.MSG_TRUNC)
+			if rerr == unix.EAGAIN {
+				return false
+			}
+			if rerr != nil {
+				return true
+			}
+			if n > len(buf) {
+				buf = make([]byte, n)
+			}
+			n, _, rerr = unix.Recvfrom(int(fd), buf, 0)
+			return rerr != unix.EAGAIN
+		})
+		if err != nil {
+			return err
+		}
+		if rerr != nil {
+			return rerr
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			if m.Header.Seq != req.Header.Sequence {
+				continue
+			}
+			switch m.Header.Type {
+			case unix.NLMSG_DONE, unix.NLMSG_ERROR:
+				// Both carry an error code, which is 0 on success.
+				if len(m.Data) < 4 {
+					return fmt.Errorf("short netlink message of type %d", m.Header.Type)
+				}
+				if code := int32(native.Endian.Uint32(m.Data)); code < 0 {
+					return syscall.Errno(-code)
+				}
+				return nil
+			}
+			if err := fn(netlink.Message{
+				Header: netlink.Header{
+					Length:   m.Header.Len,
+					Type:     netlink.HeaderType(m.Header.Type),
+					Flags:    netlink.HeaderFlags(m.Header.Flags),
+					Sequence: m.Header.Seq,
+					PID:      m.Header.Pid,
+				},
+				Data: m.Data,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func nfnetlinkDumpRequest(subsys, msgType uint16) netlink.Message {
+	return netlink.Message{
+		Header: netlink.Header{
+			Type:  netlink.HeaderType(subsys<<8 | msgType),
+			Flags: netlink.Request | netlink.Dump,
+		},
+		Data: []byte{unix.AF_UNSPEC, unix.NFNETLINK_V0, 0, 0},
+	}
+}
+
+// nfnetlinkAttributes returns a decoder of the attributes of an nfnetlink
+// message, which are in network byte order.
+func nfnetlinkAttributes(m netlink.Message) (*netlink.AttributeDecoder, error) {
+	if len(m.Data) < sizeOfNfgenmsg {
+		return nil, fmt.Errorf("short nfnetlink message of %d bytes", len(m.Data))
+	}
+	ad, err := netlink.NewAttributeDecoder(m.Data[sizeOfNfgenmsg:])
+	if err != nil {
+		return nil, err
+	}
+	ad.ByteOrder = binary.BigEndian
+	return ad, nil
+}
+
+// readNetlinkMessages reads netlink messages as received from the kernel.
+func readNetlinkMessages(path string) ([]netlink.Message, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid netlink messages in %s: %w", path, err)
+	}
+	res := make([]netlink.Message, 0, len(msgs))
+	for _, m := range msgs {
+		res = append(res, netlink.Message{
+			Header: netlink.Header{
+				Length:   m.Header.Len,
+				Type:     netlink.HeaderType(m.Header.Type),
+				Flags:    netlink.HeaderFlags(m.Header.Flags),
+				Sequence: m.Header.Seq,
+				PID:      m.Header.Pid,
+			},
+			Data: m.Data,
+		})
+	}
+	return res, nil
+}
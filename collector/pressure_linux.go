@@ -29,15 +29,17 @@ import (
 )
 
 var (
-	psiResources = []string{"cpu", "io", "memory"}
+	psiResources = []string{"cpu", "io", "memory", "irq"}
 )
 
 type pressureStatsCollector struct {
 	cpu     *prometheus.Desc
+	cpuFull *prometheus.Desc
 	io      *prometheus.Desc
 	ioFull  *prometheus.Desc
 	mem     *prometheus.Desc
 	memFull *prometheus.Desc
+	irqFull *prometheus.Desc
 
 	fs procfs.FS
 
@@ -61,6 +63,11 @@ func NewPressureStatsCollector(logger log.Logger) (Collector, error) {
 			"Total time in seconds that processes have waited for CPU time",
 			nil, nil,
 		),
+		cpuFull: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pressure", "cpu_stalled_seconds_total"),
+			"Total time in seconds no process could make progress due to CPU congestion",
+			nil, nil,
+		),
 		io: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "pressure", "io_waiting_seconds_total"),
 			"Total time in seconds that processes have waited due to IO congestion",
@@ -81,6 +88,11 @@ func NewPressureStatsCollector(logger log.Logger) (Collector, error) {
 			"Total time in seconds no process could make progress due to memory congestion",
 			nil, nil,
 		),
+		irqFull: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pressure", "irq_stalled_seconds_total"),
+			"Total time in seconds no process could make progress due to IRQ/SoftIRQ processing",
+			nil, nil,
+		),
 		fs:     fs,
 		logger: logger,
 	}, nil
@@ -92,6 +104,10 @@ func (c *pressureStatsCollector) Update(ch chan<- prometheus.Metric) error {
 		level.Debug(c.logger).Log("msg", "collecting statistics for resource", "resource", res)
 		vals, err := c.fs.PSIStatsForResource(res)
 		if err != nil {
+			if res == "irq" && errors.Is(err, os.ErrNotExist) {
+				level.Debug(c.logger).Log("msg", "IRQ pressure information is unavailable, you need a Linux kernel >= 6.1 with CONFIG_IRQ_TIME_ACCOUNTING enabled")
+				continue
+			}
 			if errors.Is(err, os.ErrNotExist) {
 				level.Debug(c.logger).Log("msg", "pressure information is unavailable, you need a Linux kernel >= 4.20 and/or CONFIG_PSI enabled for your kernel")
 				return ErrNoData
@@ -105,12 +121,21 @@ func (c *pressureStatsCollector) Update(ch chan<- prometheus.Metric) error {
 		switch res {
 		case "cpu":
 			ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.CounterValue, float64(vals.Some.Total)/1000.0/1000.0)
+			// The full line for CPU was added in Linux 5.13.
+			if vals.Full != nil {
+				ch <- prometheus.MustNewConstMetric(c.cpuFull, prometheus.CounterValue, float64(vals.Full.Total)/1000.0/1000.0)
+			}
 		case "io":
 			ch <- prometheus.MustNewConstMetric(c.io, prometheus.CounterValue, float64(vals.Some.Total)/1000.0/1000.0)
 			ch <- prometheus.MustNewConstMetric(c.ioFull, prometheus.CounterValue, float64(vals.Full.Total)/1000.0/1000.0)
 		case "memory":
 			ch <- prometheus.MustNewConstMetric(c.mem, prometheus.CounterValue, float64(vals.Some.Total)/1000.0/1000.0)
 			ch <- prometheus.MustNewConstMetric(c.memFull, prometheus.CounterValue, float64(vals.Full.Total)/1000.0/1000.0)
+		case "irq":
+			// IRQ pressure only has a full line.
+			if vals.Full != nil {
+				ch <- prometheus.MustNewConstMetric(c.irqFull, prometheus.CounterValue, float64(vals.Full.Total)/1000.0/1000.0)
+			}
 		default:
 			level.Debug(c.logger).Log("msg", "did not account for resource", "resource", res)
 		}
@@ -17,22 +17,30 @@
 package collector
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"path"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 
+	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/procfs"
 )
 
+var processesWorkers = kingpin.Flag("collector.processes.workers", "Number of processes read in parallel, 0 for GOMAXPROCS.").Default("0").Int()
+
 type processCollector struct {
 	fs           procfs.FS
+	workers      int
 	threadAlloc  *prometheus.Desc
 	threadLimit  *prometheus.Desc
 	threadsState *prometheus.Desc
@@ -54,7 +62,8 @@ func NewProcessStatCollector(logger log.Logger) (Collector, error) {
 	}
 	subsystem := "processes"
 	return &processCollector{
-		fs: fs,
+		fs:      fs,
+		workers: *processesWorkers,
 		threadAlloc: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, subsystem, "threads"),
 			"Allocated threads in system",
@@ -115,50 +124,131 @@ func (c *processCollector) Update(ch chan<- prometheus.Metric) error {
 	return nil
 }
 
+// processWalkResult accumulates the statistics of the processes handled by a
+// single worker.
+type processWalkResult struct {
+	pids         int
+	threads      int
+	procStates   map[string]int32
+	threadStates map[string]int32
+}
+
 func (c *processCollector) getAllocatedThreads() (int, map[string]int32, int, map[string]int32, error) {
 	p, err := c.fs.AllProcs()
 	if err != nil {
 		return 0, nil, 0, nil, fmt.Errorf("unable to list all processes: %w", err)
 	}
-	pids := 0
-	thread := 0
-	procStates := make(map[string]int32)
-	threadStates := make(map[string]int32)
 
-	for _, pid := range p {
-		stat, err := pid.Stat()
-		if err != nil {
-			// PIDs can vanish between getting the list and getting stats.
-			if c.isIgnoredError(err) {
-				level.Debug(c.logger).Log("msg", "file not found when retrieving stats for pid", "pid", pid.PID, "err", err)
-				continue
+	workers := c.workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(p) {
+		workers = len(p)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		pids    = make(chan int)
+		done    = make(chan struct{})
+		stop    sync.Once
+		results = make([]processWalkResult, workers)
+		errs    = make([]error, workers)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := processWalker{
+				collector: c,
+				buf:       make([]byte, 0, 1024),
+				result: processWalkResult{
+					procStates:   make(map[string]int32),
+					threadStates: make(map[string]int32),
+				},
 			}
-			level.Debug(c.logger).Log("msg", "error reading stat for pid", "pid", pid.PID, "err", err)
-			return 0, nil, 0, nil, fmt.Errorf("error reading stat for pid %d: %w", pid.PID, err)
+			for pid := range pids {
+				if err := w.walkProcess(pid); err != nil {
+					errs[i] = err
+					// Stop the producer; the other workers drain the
+					// remaining PIDs as it notices. Several workers may
+					// fail at once, but done must be closed only once.
+					stop.Do(func() { close(done) })
+					break
+				}
+			}
+			// Keep consuming so the producer never blocks on a worker
+			// that gave up.
+			for range pids {
+			}
+			results[i] = w.result
+		}(i)
+	}
+produce:
+	for _, proc := range p {
+		select {
+		case pids <- proc.PID:
+		case <-done:
+			break produce
 		}
-		pids++
-		procStates[stat.State]++
-		thread += stat.NumThreads
-		err = c.getThreadStates(pid.PID, stat, threadStates)
+	}
+	close(pids)
+	wg.Wait()
+
+	for _, err := range errs {
 		if err != nil {
 			return 0, nil, 0, nil, err
 		}
 	}
-	return pids, procStates, thread, threadStates, nil
+
+	total := processWalkResult{
+		procStates:   make(map[string]int32),
+		threadStates: make(map[string]int32),
+	}
+	for _, r := range results {
+		total.pids += r.pids
+		total.threads += r.threads
+		for state, n := range r.procStates {
+			total.procStates[state] += n
+		}
+		for state, n := range r.threadStates {
+			total.threadStates[state] += n
+		}
+	}
+	return total.pids, total.procStates, total.threads, total.threadStates, nil
+}
+
+// processWalker reads the stat files of processes and their threads, reusing
+// a single read buffer.
+type processWalker struct {
+	collector *processCollector
+	buf       []byte
+	result    processWalkResult
 }
 
-func (c *processCollector) getThreadStates(pid int, pidStat procfs.ProcStat, threadStates map[string]int32) error {
-	fs, err := procfs.NewFS(procFilePath(path.Join(strconv.Itoa(pid), "task")))
+func (w *processWalker) walkProcess(pid int) error {
+	c := w.collector
+	dir := procFilePath(strconv.Itoa(pid))
+	state, numThreads, err := w.readStat(filepath.Join(dir, "stat"))
 	if err != nil {
+		// PIDs can vanish between getting the list and getting stats.
 		if c.isIgnoredError(err) {
-			level.Debug(c.logger).Log("msg", "file not found when retrieving tasks for pid", "pid", pid, "err", err)
+			level.Debug(c.logger).Log("msg", "file not found when retrieving stats for pid", "pid", pid, "err", err)
 			return nil
 		}
-		level.Debug(c.logger).Log("msg", "error reading tasks for pid", "pid", pid, "err", err)
-		return fmt.Errorf("error reading task for pid %d: %w", pid, err)
+		level.Debug(c.logger).Log("msg", "error reading stat for pid", "pid", pid, "err", err)
+		return fmt.Errorf("error reading stat for pid %d: %w", pid, err)
 	}
+	w.result.pids++
+	w.result.procStates[state]++
+	w.result.threads += numThreads
+	return w.walkThreads(pid, dir, state)
+}
 
-	t, err := fs.AllProcs()
+func (w *processWalker) walkThreads(pid int, dir, pidState string) error {
+	c := w.collector
+	taskDir := filepath.Join(dir, "task")
+	tids, err := readDirNames(taskDir)
 	if err != nil {
 		if c.isIgnoredError(err) {
 			level.Debug(c.logger).Log("msg", "file not found when retrieving tasks for pid", "pid", pid, "err", err)
@@ -167,25 +257,102 @@ func (c *processCollector) getThreadStates(pid int, pidStat procfs.ProcStat, thr
 		return fmt.Errorf("unable to list all threads for pid: %d %w", pid, err)
 	}
 
-	for _, thread := range t {
-		if pid == thread.PID {
-			threadStates[pidStat.State]++
+	self := strconv.Itoa(pid)
+	for _, tid := range tids {
+		if tid == self {
+			w.result.threadStates[pidState]++
 			continue
 		}
-		threadStat, err := thread.Stat()
+		if _, err := strconv.Atoi(tid); err != nil {
+			continue
+		}
+		state, _, err := w.readStat(filepath.Join(taskDir, tid, "stat"))
 		if err != nil {
 			if c.isIgnoredError(err) {
-				level.Debug(c.logger).Log("msg", "file not found when retrieving stats for thread", "pid", pid, "threadId", thread.PID, "err", err)
+				level.Debug(c.logger).Log("msg", "file not found when retrieving stats for thread", "pid", pid, "threadId", tid, "err", err)
 				continue
 			}
-			level.Debug(c.logger).Log("msg", "error reading stat for thread", "pid", pid, "threadId", thread.PID, "err", err)
-			return fmt.Errorf("error reading stat for pid:%d thread:%d err:%w", pid, thread.PID, err)
+			level.Debug(c.logger).Log("msg", "error reading stat for thread", "pid", pid, "threadId", tid, "err", err)
+			return fmt.Errorf("error reading stat for pid:%d thread:%s err:%w", pid, tid, err)
 		}
-		threadStates[threadStat.State]++
+		w.result.threadStates[state]++
 	}
 	return nil
 }
 
+// readStat returns the state and number of threads from a stat file of a
+// process or thread.
+func (w *processWalker) readStat(path string) (string, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	w.buf = w.buf[:0]
+	for {
+		if len(w.buf) == cap(w.buf) {
+			w.buf = append(w.buf, 0)[:len(w.buf)]
+		}
+		n, err := f.Read(w.buf[len(w.buf):cap(w.buf)])
+		w.buf = w.buf[:len(w.buf)+n]
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", 0, err
+		}
+	}
+	return parseProcStat(w.buf)
+}
+
+// parseProcStat extracts the state and number of threads from the contents
+// of /proc/<pid>/stat. The command name may contain spaces and parentheses,
+// so fields are counted from the last closing parenthesis.
+func parseProcStat(data []byte) (string, int, error) {
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return "", 0, fmt.Errorf("invalid stat line %q", data)
+	}
+	// After the command name follow state (field 3) up to num_threads
+	// (field 20).
+	fields := data[i+1:]
+	var state string
+	for field := 3; field <= 20; field++ {
+		fields = bytes.TrimLeft(fields, " ")
+		end := bytes.IndexByte(fields, ' ')
+		if end < 0 {
+			end = len(fields)
+		}
+		value := fields[:end]
+		fields = fields[end:]
+		switch field {
+		case 3:
+			if len(value) == 0 {
+				return "", 0, fmt.Errorf("missing state in stat line %q", data)
+			}
+			state = string(value)
+		case 20:
+			numThreads, err := strconv.Atoi(string(bytes.TrimSpace(value)))
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid num_threads in stat line %q: %w", data, err)
+			}
+			return state, numThreads, nil
+		}
+	}
+	return "", 0, fmt.Errorf("invalid stat line %q", data)
+}
+
+// readDirNames returns the names of the entries of dir without stating them.
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
+
 func (c *processCollector) isIgnoredError(err error) bool {
 	if errors.Is(err, os.ErrNotExist) || strings.Contains(err.Error(), syscall.ESRCH.Error()) {
 		return true
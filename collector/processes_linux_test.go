@@ -17,6 +17,11 @@
 package collector
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"testing"
 
 	"github.com/alecthomas/kingpin/v2"
@@ -53,3 +58,138 @@ func TestReadProcessStatus(t *testing.T) {
 		t.Fatalf("Total running pids cannot be greater than %d or equals to 0", maxPid)
 	}
 }
+
+var syntheticProcStates = []string{"S", "R", "D", "I"}
+
+// writeSyntheticProc creates a /proc tree below dir with procs processes of
+// threads threads each, and returns the expected walk result.
+func writeSyntheticProc(tb testing.TB, dir string, procs, threads int) processWalkResult {
+	want := processWalkResult{
+		procStates:   map[string]int32{},
+		threadStates: map[string]int32{},
+	}
+	stat := func(pid int, comm, state string, numThreads int) []byte {
+		return []byte(fmt.Sprintf("%d (%s) %s 1 %d %d 0 -1 4194560 9061 9416027 94 2620 36 98 54406 13885 20 0 %d 0 29 109604864 2507 18446744073709551615 1 1 0 0 0 0 671173123 4096 1260 0 0 0 17 0 0 0 19 0 0 0 0 0 0 0 0 0 0\n",
+			pid, comm, state, pid, pid, numThreads))
+	}
+	for i := 0; i < procs; i++ {
+		pid := 100 + i*(threads+1)
+		state := syntheticProcStates[i%len(syntheticProcStates)]
+		pidDir := filepath.Join(dir, strconv.Itoa(pid))
+		// Command names may contain spaces and parentheses.
+		comm := fmt.Sprintf("worker %d (x)", i)
+		for t := 0; t < threads; t++ {
+			tid := pid + t
+			tidDir := filepath.Join(pidDir, "task", strconv.Itoa(tid))
+			if err := os.MkdirAll(tidDir, 0o755); err != nil {
+				tb.Fatal(err)
+			}
+			threadState := state
+			if t > 0 {
+				threadState = syntheticProcStates[(i+t)%len(syntheticProcStates)]
+			}
+			if err := os.WriteFile(filepath.Join(tidDir, "stat"), stat(tid, comm, threadState, threads), 0o644); err != nil {
+				tb.Fatal(err)
+			}
+			want.threadStates[threadState]++
+		}
+		if err := os.WriteFile(filepath.Join(pidDir, "stat"), stat(pid, comm, state, threads), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+		want.pids++
+		want.threads += threads
+		want.procStates[state]++
+	}
+	return want
+}
+
+func TestGetAllocatedThreadsSynthetic(t *testing.T) {
+	dir := t.TempDir()
+	want := writeSyntheticProc(t, dir, 50, 4)
+
+	oldProcPath := *procPath
+	defer func() { *procPath = oldProcPath }()
+	*procPath = dir
+
+	fs, err := procfs.NewFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{1, 3, 0} {
+		c := processCollector{fs: fs, workers: workers, logger: log.NewNopLogger()}
+		pids, states, threads, threadStates, err := c.getAllocatedThreads()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := processWalkResult{pids: pids, threads: threads, procStates: states, threadStates: threadStates}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("workers %d: want %+v, got %+v", workers, want, got)
+		}
+	}
+}
+
+func TestGetAllocatedThreadsErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeSyntheticProc(t, dir, 50, 1)
+	// Make every process unreadable, so that all workers fail.
+	pidDirs, err := filepath.Glob(filepath.Join(dir, "[0-9]*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pidDir := range pidDirs {
+		if err := os.WriteFile(filepath.Join(pidDir, "stat"), []byte("42 (a) R 1\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldProcPath := *procPath
+	defer func() { *procPath = oldProcPath }()
+	*procPath = dir
+
+	fs, err := procfs.NewFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := processCollector{fs: fs, workers: 4, logger: log.NewNopLogger()}
+	if _, _, _, _, err := c.getAllocatedThreads(); err == nil {
+		t.Error("expected error for invalid stat files")
+	}
+}
+
+func TestParseProcStat(t *testing.T) {
+	state, threads, err := parseProcStat([]byte("42 (a) b) c) R 1 42 42 0 -1 4194560 0 0 0 0 0 0 0 0 20 0 7 0 29\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != "R" || threads != 7 {
+		t.Errorf("want state R and 7 threads, got %s and %d", state, threads)
+	}
+	if _, _, err := parseProcStat([]byte("42 (a) R 1")); err == nil {
+		t.Error("expected error for truncated stat line")
+	}
+}
+
+func BenchmarkGetAllocatedThreads(b *testing.B) {
+	dir := b.TempDir()
+	writeSyntheticProc(b, dir, 1000, 10)
+
+	oldProcPath := *procPath
+	defer func() { *procPath = oldProcPath }()
+	*procPath = dir
+
+	fs, err := procfs.NewFS(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, workers := range []int{1, 4, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			c := processCollector{fs: fs, workers: workers, logger: log.NewNopLogger()}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, _, _, _, err := c.getAllocatedThreads(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
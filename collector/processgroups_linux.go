@@ -0,0 +1,392 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noprocessgroups
+// +build !noprocessgroups
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+	"gopkg.in/yaml.v2"
+)
+
+// processGroupUserHZ is the unit of the CPU times in /proc/<pid>/stat, which
+// is fixed at 100 on Linux.
+const processGroupUserHZ = 100
+
+var processGroupsConfigFile = kingpin.Flag("collector.processgroups.config-file", "Path to the YAML file defining the process groups.").Default("").String()
+
+// processGroupsConfig is the format of the process groups configuration file.
+type processGroupsConfig struct {
+	Groups []processGroupSpec `yaml:"groups"`
+}
+
+// processGroupSpec selects the processes of a group. All criteria that are
+// set must match, and a process matching any of the listed values of a
+// criterion matches it.
+type processGroupSpec struct {
+	Name    string   `yaml:"name"`
+	Comm    []string `yaml:"comm"`
+	Exe     []string `yaml:"exe"`
+	Cmdline string   `yaml:"cmdline"`
+	User    []string `yaml:"user"`
+}
+
+// processGroup is a compiled processGroupSpec.
+type processGroup struct {
+	name    string
+	comm    map[string]bool
+	exe     map[string]bool
+	cmdline *regexp.Regexp
+	uids    map[string]bool
+}
+
+// processKey identifies a process across PID reuse.
+type processKey struct {
+	pid       int
+	startTime uint64
+}
+
+// processCounters are the cumulative values of a process, or of a group.
+type processCounters struct {
+	cpuUser, cpuSystem      float64
+	readBytes, writeBytes   float64
+	voluntary, nonvoluntary float64
+}
+
+// add adds the increase from prev to cur to c.
+func (c *processCounters) add(cur, prev processCounters) {
+	delta := func(cur, prev float64) float64 {
+		if cur < prev {
+			return 0
+		}
+		return cur - prev
+	}
+	c.cpuUser += delta(cur.cpuUser, prev.cpuUser)
+	c.cpuSystem += delta(cur.cpuSystem, prev.cpuSystem)
+	c.readBytes += delta(cur.readBytes, prev.readBytes)
+	c.writeBytes += delta(cur.writeBytes, prev.writeBytes)
+	c.voluntary += delta(cur.voluntary, prev.voluntary)
+	c.nonvoluntary += delta(cur.nonvoluntary, prev.nonvoluntary)
+}
+
+// processGroupGauges are the current values of a group.
+type processGroupGauges struct {
+	processes, threads, rss, pss, fds float64
+}
+
+type processGroupsCollector struct {
+	fs     procfs.FS
+	groups []processGroup
+
+	processes       typedDesc
+	threads         typedDesc
+	cpu             typedDesc
+	residentMemory  typedDesc
+	proportionalMem typedDesc
+	openFDs         typedDesc
+	contextSwitches typedDesc
+	readBytes       typedDesc
+	writtenBytes    typedDesc
+	logger          log.Logger
+
+	mtx sync.Mutex
+	// Counters of the processes seen in the previous scrape, and the
+	// accumulated counters of each group, which keep the contribution of
+	// processes that have exited so the group counters never decrease.
+	seen   map[processKey]processCounters
+	totals map[string]*processCounters
+}
+
+func init() {
+	registerCollector("processgroups", defaultDisabled, NewProcessGroupsCollector)
+}
+
+// NewProcessGroupsCollector returns a new Collector exposing aggregated
+// resource usage of the process groups in the process groups configuration
+// file.
+func NewProcessGroupsCollector(logger log.Logger) (Collector, error) {
+	const subsystem = "processgroup"
+
+	if *processGroupsConfigFile == "" {
+		return nil, errors.New("--collector.processgroups.config-file must be set")
+	}
+	groups, err := loadProcessGroupsConfig(*processGroupsConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open procfs: %w", err)
+	}
+
+	groupDesc := func(name, help string, valueType prometheus.ValueType, labels ...string) typedDesc {
+		return typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, name),
+			help, append([]string{"group"}, labels...), nil,
+		), valueType}
+	}
+
+	totals := map[string]*processCounters{}
+	for _, g := range groups {
+		totals[g.name] = &processCounters{}
+	}
+
+	return &processGroupsCollector{
+		fs:              fs,
+		groups:          groups,
+		processes:       groupDesc("processes", "Number of processes in the group.", prometheus.GaugeValue),
+		threads:         groupDesc("threads", "Number of threads of the processes in the group.", prometheus.GaugeValue),
+		cpu:             groupDesc("cpu_seconds_total", "CPU time consumed by the processes in the group.", prometheus.CounterValue, "mode"),
+		residentMemory:  groupDesc("resident_memory_bytes", "Resident memory of the processes in the group.", prometheus.GaugeValue),
+		proportionalMem: groupDesc("proportional_memory_bytes", "Proportional set size of the processes in the group, counting shared pages once.", prometheus.GaugeValue),
+		openFDs:         groupDesc("open_fds", "Number of open file descriptors of the processes in the group.", prometheus.GaugeValue),
+		contextSwitches: groupDesc("context_switches_total", "Context switches of the processes in the group.", prometheus.CounterValue, "ctxswitchtype"),
+		readBytes:       groupDesc("read_bytes_total", "Bytes read from storage by the processes in the group.", prometheus.CounterValue),
+		writtenBytes:    groupDesc("written_bytes_total", "Bytes written to storage by the processes in the group.", prometheus.CounterValue),
+		logger:          logger,
+		seen:            map[processKey]processCounters{},
+		totals:          totals,
+	}, nil
+}
+
+func loadProcessGroupsConfig(path string) ([]processGroup, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read process groups config: %w", err)
+	}
+	var cfg processGroupsConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse process groups config %q: %w", path, err)
+	}
+
+	groups := make([]processGroup, 0, len(cfg.Groups))
+	seen := map[string]struct{}{}
+	for i, spec := range cfg.Groups {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("process group %d in %q needs a name", i, path)
+		}
+		if _, ok := seen[spec.Name]; ok {
+			return nil, fmt.Errorf("duplicate process group name %q in %q", spec.Name, path)
+		}
+		seen[spec.Name] = struct{}{}
+		if len(spec.Comm) == 0 && len(spec.Exe) == 0 && spec.Cmdline == "" && len(spec.User) == 0 {
+			return nil, fmt.Errorf("process group %q in %q has no match criteria", spec.Name, path)
+		}
+
+		g := processGroup{
+			name: spec.Name,
+			comm: stringSet(spec.Comm),
+			exe:  stringSet(spec.Exe),
+		}
+		if spec.Cmdline != "" {
+			if g.cmdline, err = regexp.Compile(spec.Cmdline); err != nil {
+				return nil, fmt.Errorf("invalid cmdline regexp of process group %q: %w", spec.Name, err)
+			}
+		}
+		if len(spec.User) > 0 {
+			g.uids = map[string]bool{}
+			for _, name := range spec.User {
+				uid, err := lookupUID(name)
+				if err != nil {
+					return nil, fmt.Errorf("invalid user of process group %q: %w", spec.Name, err)
+				}
+				g.uids[uid] = true
+			}
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+func stringSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// lookupUID resolves a user name or numeric UID to a UID.
+func lookupUID(name string) (string, error) {
+	if _, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return name, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.Uid, nil
+}
+
+// Update implements the Collector interface.
+func (c *processGroupsCollector) Update(ch chan<- prometheus.Metric) error {
+	procs, err := c.fs.AllProcs()
+	if err != nil {
+		return fmt.Errorf("unable to list all processes: %w", err)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	gauges := map[string]*processGroupGauges{}
+	for _, g := range c.groups {
+		gauges[g.name] = &processGroupGauges{}
+	}
+	seen := make(map[processKey]processCounters, len(c.seen))
+	for _, p := range procs {
+		if err := c.updateProcess(p, gauges, seen); err != nil {
+			if isProcessGoneError(err) {
+				level.Debug(c.logger).Log("msg", "process vanished while reading it", "pid", p.PID, "err", err)
+				continue
+			}
+			return fmt.Errorf("error reading process %d: %w", p.PID, err)
+		}
+	}
+	c.seen = seen
+
+	for _, g := range c.groups {
+		gauge, total := gauges[g.name], c.totals[g.name]
+		ch <- c.processes.mustNewConstMetric(gauge.processes, g.name)
+		ch <- c.threads.mustNewConstMetric(gauge.threads, g.name)
+		ch <- c.residentMemory.mustNewConstMetric(gauge.rss, g.name)
+		ch <- c.proportionalMem.mustNewConstMetric(gauge.pss, g.name)
+		ch <- c.openFDs.mustNewConstMetric(gauge.fds, g.name)
+		ch <- c.cpu.mustNewConstMetric(total.cpuUser, g.name, "user")
+		ch <- c.cpu.mustNewConstMetric(total.cpuSystem, g.name, "system")
+		ch <- c.contextSwitches.mustNewConstMetric(total.voluntary, g.name, "voluntary")
+		ch <- c.contextSwitches.mustNewConstMetric(total.nonvoluntary, g.name, "nonvoluntary")
+		ch <- c.readBytes.mustNewConstMetric(total.readBytes, g.name)
+		ch <- c.writtenBytes.mustNewConstMetric(total.writeBytes, g.name)
+	}
+	return nil
+}
+
+// updateProcess adds p to the group it belongs to, if any.
+func (c *processGroupsCollector) updateProcess(p procfs.Proc, gauges map[string]*processGroupGauges, seen map[processKey]processCounters) error {
+	stat, err := p.Stat()
+	if err != nil {
+		return err
+	}
+	status, err := p.NewStatus()
+	if err != nil {
+		return err
+	}
+	g, err := c.match(p, stat, status)
+	if err != nil || g == nil {
+		return err
+	}
+
+	gauge := gauges[g.name]
+	gauge.processes++
+	gauge.threads += float64(stat.NumThreads)
+	gauge.rss += float64(status.VmRSS)
+
+	cur := processCounters{
+		cpuUser:      float64(stat.UTime) / processGroupUserHZ,
+		cpuSystem:    float64(stat.STime) / processGroupUserHZ,
+		voluntary:    float64(status.VoluntaryCtxtSwitches),
+		nonvoluntary: float64(status.NonVoluntaryCtxtSwitches),
+	}
+
+	// The remaining files are unreadable for processes of other users
+	// without CAP_SYS_PTRACE, and some are missing for kernel threads.
+	if smaps, err := p.ProcSMapsRollup(); err == nil {
+		gauge.pss += float64(smaps.Pss)
+	} else {
+		level.Debug(c.logger).Log("msg", "failed to read smaps_rollup", "pid", p.PID, "err", err)
+	}
+	if fds, err := p.FileDescriptorsLen(); err == nil {
+		gauge.fds += float64(fds)
+	} else {
+		level.Debug(c.logger).Log("msg", "failed to read file descriptors", "pid", p.PID, "err", err)
+	}
+	if io, err := p.IO(); err == nil {
+		cur.readBytes = float64(io.ReadBytes)
+		cur.writeBytes = float64(io.WriteBytes)
+	} else {
+		level.Debug(c.logger).Log("msg", "failed to read io", "pid", p.PID, "err", err)
+	}
+
+	key := processKey{pid: p.PID, startTime: stat.Starttime}
+	c.totals[g.name].add(cur, c.seen[key])
+	seen[key] = cur
+	return nil
+}
+
+// match returns the first group p belongs to, or nil.
+func (c *processGroupsCollector) match(p procfs.Proc, stat procfs.ProcStat, status procfs.ProcStatus) (*processGroup, error) {
+	var (
+		exe, cmdline         string
+		haveExe, haveCmdline bool
+	)
+	for i := range c.groups {
+		g := &c.groups[i]
+		if g.comm != nil && !g.comm[stat.Comm] {
+			continue
+		}
+		if g.uids != nil && !g.uids[status.UIDs[0]] {
+			continue
+		}
+		if g.exe != nil {
+			if !haveExe {
+				// Kernel threads have no executable, and the link is
+				// unreadable for processes of other users.
+				exe, _ = p.Executable()
+				haveExe = true
+			}
+			if !g.exe[exe] {
+				continue
+			}
+		}
+		if g.cmdline != nil {
+			if !haveCmdline {
+				args, err := p.CmdLine()
+				if err != nil {
+					return nil, err
+				}
+				cmdline = strings.Join(args, " ")
+				haveCmdline = true
+			}
+			if !g.cmdline.MatchString(cmdline) {
+				continue
+			}
+		}
+		return g, nil
+	}
+	return nil, nil
+}
+
+// isProcessGoneError reports whether err was caused by the process exiting
+// while it was being read.
+func isProcessGoneError(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ESRCH) || strings.Contains(err.Error(), syscall.ESRCH.Error())
+}
@@ -0,0 +1,163 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noprocessgroups
+// +build !noprocessgroups
+
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type testProcessGroupsCollector struct {
+	pc Collector
+}
+
+func (c testProcessGroupsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.pc.Update(ch)
+}
+
+func (c testProcessGroupsCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func TestProcessGroupsCollector(t *testing.T) {
+	config := `
+groups:
+  - name: systemd
+    comm: [systemd]
+  - name: init
+    cmdline: ^/sbin/init
+  - name: root
+    user: ["0"]
+  - name: nginx
+    exe: [/usr/sbin/nginx]
+`
+	expected := `# HELP node_processgroup_context_switches_total Context switches of the processes in the group.
+# TYPE node_processgroup_context_switches_total counter
+node_processgroup_context_switches_total{ctxswitchtype="nonvoluntary",group="init"} 0
+node_processgroup_context_switches_total{ctxswitchtype="nonvoluntary",group="nginx"} 0
+node_processgroup_context_switches_total{ctxswitchtype="nonvoluntary",group="root"} 17
+node_processgroup_context_switches_total{ctxswitchtype="nonvoluntary",group="systemd"} 2186
+node_processgroup_context_switches_total{ctxswitchtype="voluntary",group="init"} 0
+node_processgroup_context_switches_total{ctxswitchtype="voluntary",group="nginx"} 0
+node_processgroup_context_switches_total{ctxswitchtype="voluntary",group="root"} 9.113802e+06
+node_processgroup_context_switches_total{ctxswitchtype="voluntary",group="systemd"} 38131
+# HELP node_processgroup_cpu_seconds_total CPU time consumed by the processes in the group.
+# TYPE node_processgroup_cpu_seconds_total counter
+node_processgroup_cpu_seconds_total{group="init",mode="system"} 0
+node_processgroup_cpu_seconds_total{group="init",mode="user"} 0
+node_processgroup_cpu_seconds_total{group="nginx",mode="system"} 0
+node_processgroup_cpu_seconds_total{group="nginx",mode="user"} 0
+node_processgroup_cpu_seconds_total{group="root",mode="system"} 3.46
+node_processgroup_cpu_seconds_total{group="root",mode="user"} 0
+node_processgroup_cpu_seconds_total{group="systemd",mode="system"} 0.98
+node_processgroup_cpu_seconds_total{group="systemd",mode="user"} 0.36
+# HELP node_processgroup_open_fds Number of open file descriptors of the processes in the group.
+# TYPE node_processgroup_open_fds gauge
+node_processgroup_open_fds{group="init"} 0
+node_processgroup_open_fds{group="nginx"} 0
+node_processgroup_open_fds{group="root"} 0
+node_processgroup_open_fds{group="systemd"} 5
+# HELP node_processgroup_processes Number of processes in the group.
+# TYPE node_processgroup_processes gauge
+node_processgroup_processes{group="init"} 0
+node_processgroup_processes{group="nginx"} 0
+node_processgroup_processes{group="root"} 1
+node_processgroup_processes{group="systemd"} 1
+# HELP node_processgroup_proportional_memory_bytes Proportional set size of the processes in the group, counting shared pages once.
+# TYPE node_processgroup_proportional_memory_bytes gauge
+node_processgroup_proportional_memory_bytes{group="init"} 0
+node_processgroup_proportional_memory_bytes{group="nginx"} 0
+node_processgroup_proportional_memory_bytes{group="root"} 0
+node_processgroup_proportional_memory_bytes{group="systemd"} 4.877312e+06
+# HELP node_processgroup_read_bytes_total Bytes read from storage by the processes in the group.
+# TYPE node_processgroup_read_bytes_total counter
+node_processgroup_read_bytes_total{group="init"} 0
+node_processgroup_read_bytes_total{group="nginx"} 0
+node_processgroup_read_bytes_total{group="root"} 0
+node_processgroup_read_bytes_total{group="systemd"} 5.4142976e+08
+# HELP node_processgroup_resident_memory_bytes Resident memory of the processes in the group.
+# TYPE node_processgroup_resident_memory_bytes gauge
+node_processgroup_resident_memory_bytes{group="init"} 0
+node_processgroup_resident_memory_bytes{group="nginx"} 0
+node_processgroup_resident_memory_bytes{group="root"} 0
+node_processgroup_resident_memory_bytes{group="systemd"} 1.0268672e+07
+# HELP node_processgroup_threads Number of threads of the processes in the group.
+# TYPE node_processgroup_threads gauge
+node_processgroup_threads{group="init"} 0
+node_processgroup_threads{group="nginx"} 0
+node_processgroup_threads{group="root"} 1
+node_processgroup_threads{group="systemd"} 1
+# HELP node_processgroup_written_bytes_total Bytes written to storage by the processes in the group.
+# TYPE node_processgroup_written_bytes_total counter
+node_processgroup_written_bytes_total{group="init"} 0
+node_processgroup_written_bytes_total{group="nginx"} 0
+node_processgroup_written_bytes_total{group="root"} 0
+node_processgroup_written_bytes_total{group="systemd"} 1.04660992e+08
+`
+	path := filepath.Join(t.TempDir(), "groups.yml")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	*procPath = "fixtures/proc"
+	*processGroupsConfigFile = path
+	defer func() { *processGroupsConfigFile = "" }()
+
+	c, err := NewProcessGroupsCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&testProcessGroupsCollector{pc: c})
+
+	// Counters must not grow when scraping unchanged processes again.
+	if _, err := reg.Gather(); err != nil {
+		t.Fatal(err)
+	}
+	err = testutil.GatherAndCompare(reg, strings.NewReader(expected))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadProcessGroupsConfig(t *testing.T) {
+	tests := []struct {
+		config string
+		err    bool
+	}{
+		{config: "groups:\n  - name: a\n    comm: [a]\n"},
+		{config: "groups:\n  - comm: [a]\n", err: true},
+		{config: "groups:\n  - name: a\n", err: true},
+		{config: "groups:\n  - name: a\n    comm: [a]\n  - name: a\n    comm: [b]\n", err: true},
+		{config: "groups:\n  - name: a\n    cmdline: '('\n", err: true},
+		{config: "groups:\n  - name: a\n    comm: [a]\n    unknown: 1\n", err: true},
+	}
+	for i, test := range tests {
+		path := filepath.Join(t.TempDir(), "groups.yml")
+		if err := os.WriteFile(path, []byte(test.config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadProcessGroupsConfig(path); (err != nil) != test.err {
+			t.Errorf("%d. want error %v, got %v", i, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !norestartrequired
+// +build !norestartrequired
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+const deletedSuffix = " (deleted)"
+
+var (
+	restartRequiredCommInclude = kingpin.Flag("collector.restartrequired.comm-include", "Regexp of process names to scan.").Default("").String()
+	restartRequiredCommExclude = kingpin.Flag("collector.restartrequired.comm-exclude", "Regexp of process names not to scan.").Default("").String()
+	restartRequiredInterval    = kingpin.Flag("collector.restartrequired.interval", "Minimum time between two scans of the process memory maps, scrapes in between return the previous result.").Default("5m").Duration()
+
+	// sharedObjectRE matches the paths of shared libraries such as
+	// libssl.so.3.
+	sharedObjectRE = regexp.MustCompile(`\.so(\.[0-9.]+)?$`)
+)
+
+type restartRequiredCollector struct {
+	fs       procfs.FS
+	filter   deviceFilter
+	interval time.Duration
+
+	processes *prometheus.Desc
+	total     *prometheus.Desc
+	logger    log.Logger
+	now       func() time.Time
+
+	mtx      sync.Mutex
+	lastScan time.Time
+	// Number of processes needing a restart by executable.
+	executables map[string]int
+}
+
+func init() {
+	registerCollector("restartrequired", defaultDisabled, NewRestartRequiredCollector)
+}
+
+// NewRestartRequiredCollector returns a new Collector exposing processes that
+// still map shared libraries which were deleted, usually by a package update.
+func NewRestartRequiredCollector(logger log.Logger) (Collector, error) {
+	const subsystem = "restart_required"
+
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open procfs: %w", err)
+	}
+	return &restartRequiredCollector{
+		fs:       fs,
+		filter:   newDeviceFilter(*restartRequiredCommExclude, *restartRequiredCommInclude),
+		interval: *restartRequiredInterval,
+		processes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "processes"),
+			"Number of processes of the executable mapping deleted shared libraries.",
+			[]string{"executable"}, nil,
+		),
+		total: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "processes_all"),
+			"Number of processes mapping deleted shared libraries.",
+			nil, nil,
+		),
+		logger: logger,
+		now:    time.Now,
+	}, nil
+}
+
+// Update implements the Collector interface.
+func (c *restartRequiredCollector) Update(ch chan<- prometheus.Metric) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if now := c.now(); c.executables == nil || now.Sub(c.lastScan) >= c.interval {
+		executables, err := c.scan()
+		if err != nil {
+			return err
+		}
+		c.executables = executables
+		c.lastScan = now
+	}
+
+	var total int
+	for exe, n := range c.executables {
+		ch <- prometheus.MustNewConstMetric(c.processes, prometheus.GaugeValue, float64(n), exe)
+		total += n
+	}
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(total))
+	return nil
+}
+
+func (c *restartRequiredCollector) scan() (map[string]int, error) {
+	procs, err := c.fs.AllProcs()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list all processes: %w", err)
+	}
+
+	executables := map[string]int{}
+	for _, p := range procs {
+		comm, err := p.Comm()
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "failed to read process name", "pid", p.PID, "err", err)
+			continue
+		}
+		if c.filter.ignored(comm) {
+			continue
+		}
+		deleted, err := mapsDeletedLibrary(procFilePath(filepath.Join(strconv.Itoa(p.PID), "maps")))
+		if err != nil {
+			// The process exited, or its maps are unreadable for lack of
+			// CAP_SYS_PTRACE.
+			level.Debug(c.logger).Log("msg", "failed to read process maps", "pid", p.PID, "err", err)
+			continue
+		}
+		if !deleted {
+			continue
+		}
+		// The executable itself may have been replaced as well.
+		exe, err := p.Executable()
+		if err != nil {
+			exe = comm
+		}
+		executables[strings.TrimSuffix(exe, deletedSuffix)]++
+	}
+	return executables, nil
+}
+
+// mapsDeletedLibrary reports whether a /proc/<pid>/maps file contains a file
+// backed mapping of a shared library that has been deleted.
+func mapsDeletedLibrary(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasSuffix(line, deletedSuffix) {
+			continue
+		}
+		// The pathname is the sixth field and may contain spaces.
+		fields := strings.SplitN(line, " ", 6)
+		if len(fields) < 6 {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimLeft(fields[5], " "), deletedSuffix)
+		// Anonymous memfd mappings are always shown as deleted.
+		if strings.HasPrefix(name, "/") && !strings.HasPrefix(name, "/memfd:") && sharedObjectRE.MatchString(name) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !norestartrequired
+// +build !norestartrequired
+
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMapsDeletedLibrary(t *testing.T) {
+	tests := []struct {
+		maps    string
+		deleted bool
+	}{
+		{maps: "", deleted: false},
+		{maps: "7f3c20d2a000-7f3c20d52000 r--p 00000000 08:01 1320012                    /usr/lib/x86_64-linux-gnu/libc.so.6\n", deleted: false},
+		{maps: "7f3c20b21000-7f3c20b8f000 r--p 00000000 08:01 1320517                    /usr/lib/x86_64-linux-gnu/libssl.so.3 (deleted)\n", deleted: true},
+		{maps: "7f3c20b21000-7f3c20b8f000 r--p 00000000 08:01 1320517                    /opt/my app/lib/libfoo.so (deleted)\n", deleted: true},
+		{maps: "7f3c20a4b000-7f3c20a4c000 rw-s 00000000 00:01 2054                       /memfd:libfake.so (deleted)\n", deleted: false},
+		{maps: "7f3c20a4b000-7f3c20a4c000 rw-s 00000000 00:01 2054                       /var/lib/app/data.sock (deleted)\n", deleted: false},
+	}
+	for i, test := range tests {
+		path := filepath.Join(t.TempDir(), "maps")
+		if err := os.WriteFile(path, []byte(test.maps), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		deleted, err := mapsDeletedLibrary(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted != test.deleted {
+			t.Errorf("%d. want %v, got %v", i, test.deleted, deleted)
+		}
+	}
+}
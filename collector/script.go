@@ -0,0 +1,295 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noscript && (aix || darwin || dragonfly || freebsd || illumos || linux || netbsd || openbsd || solaris)
+// +build !noscript
+// +build aix darwin dragonfly freebsd illumos linux netbsd openbsd solaris
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"gopkg.in/yaml.v2"
+)
+
+const defaultScriptTimeout = 10 * time.Second
+
+var scriptConfigFile = kingpin.Flag("collector.script.config-file", "Path to the YAML file listing the scripts to run.").Default("").String()
+
+// scriptConfig is the format of the script collector configuration file.
+type scriptConfig struct {
+	Scripts []scriptSpec `yaml:"scripts"`
+}
+
+// scriptSpec describes a single script. With a zero interval the script runs
+// at scrape time, otherwise it runs in the background and scrapes return the
+// result of its last run.
+type scriptSpec struct {
+	Name     string            `yaml:"name"`
+	Command  string            `yaml:"command"`
+	Args     []string          `yaml:"args"`
+	Timeout  time.Duration     `yaml:"timeout"`
+	Interval time.Duration     `yaml:"interval"`
+	Env      map[string]string `yaml:"env"`
+	Dir      string            `yaml:"dir"`
+	User     string            `yaml:"user"`
+}
+
+// scriptResult holds the outcome of a single script run.
+type scriptResult struct {
+	families map[string]*dto.MetricFamily
+	success  bool
+	duration time.Duration
+	exitCode int
+}
+
+type scriptCollector struct {
+	scripts      []scriptSpec
+	successDesc  *prometheus.Desc
+	durationDesc *prometheus.Desc
+	exitCodeDesc *prometheus.Desc
+	logger       log.Logger
+
+	mtx     sync.Mutex
+	results map[string]scriptResult
+}
+
+func init() {
+	registerCollector("script", defaultDisabled, NewScriptCollector)
+}
+
+// NewScriptCollector returns a new Collector exposing metrics printed by the
+// scripts listed in the script configuration file.
+func NewScriptCollector(logger log.Logger) (Collector, error) {
+	const subsystem = "script"
+
+	if *scriptConfigFile == "" {
+		return nil, errors.New("--collector.script.config-file must be set")
+	}
+	scripts, err := loadScriptConfig(*scriptConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &scriptCollector{
+		scripts: scripts,
+		successDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "success"),
+			"Whether the last run of the script succeeded and its output could be parsed.",
+			[]string{"script"}, nil,
+		),
+		durationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "duration_seconds"),
+			"Duration of the last run of the script.",
+			[]string{"script"}, nil,
+		),
+		exitCodeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "exit_code"),
+			"Exit code of the last run of the script, -1 if it was killed or did not start.",
+			[]string{"script"}, nil,
+		),
+		logger:  logger,
+		results: map[string]scriptResult{},
+	}
+
+	for _, s := range scripts {
+		if s.Interval > 0 {
+			go c.runPeriodically(s)
+		}
+	}
+	return c, nil
+}
+
+func loadScriptConfig(path string) ([]scriptSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script config: %w", err)
+	}
+	var cfg scriptConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse script config %q: %w", path, err)
+	}
+
+	seen := map[string]struct{}{}
+	for i, s := range cfg.Scripts {
+		if s.Name == "" || s.Command == "" {
+			return nil, fmt.Errorf("script %d in %q needs a name and a command", i, path)
+		}
+		if _, ok := seen[s.Name]; ok {
+			return nil, fmt.Errorf("duplicate script name %q in %q", s.Name, path)
+		}
+		seen[s.Name] = struct{}{}
+		if s.Timeout <= 0 {
+			cfg.Scripts[i].Timeout = defaultScriptTimeout
+		}
+	}
+	return cfg.Scripts, nil
+}
+
+func (c *scriptCollector) runPeriodically(s scriptSpec) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		c.setResult(s.Name, c.run(s))
+		<-ticker.C
+	}
+}
+
+func (c *scriptCollector) setResult(name string, r scriptResult) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.results[name] = r
+}
+
+// Update implements the Collector interface.
+func (c *scriptCollector) Update(ch chan<- prometheus.Metric) error {
+	var wg sync.WaitGroup
+	for _, s := range c.scripts {
+		if s.Interval > 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(s scriptSpec) {
+			defer wg.Done()
+			c.setResult(s.Name, c.run(s))
+		}(s)
+	}
+	wg.Wait()
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	names := make([]string, 0, len(c.results))
+	for name := range c.results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		r := c.results[name]
+		for _, mf := range r.families {
+			if mf.Help == nil {
+				help := fmt.Sprintf("Metric read from script %s", name)
+				mf.Help = &help
+			}
+			convertMetricFamily(mf, ch, c.logger)
+		}
+
+		var success float64
+		if r.success {
+			success = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.successDesc, prometheus.GaugeValue, success, name)
+		ch <- prometheus.MustNewConstMetric(c.durationDesc, prometheus.GaugeValue, r.duration.Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(c.exitCodeDesc, prometheus.GaugeValue, float64(r.exitCode), name)
+	}
+	return nil
+}
+
+// run executes the script and parses its standard output. Output of failed
+// runs is discarded.
+func (c *scriptCollector) run(s scriptSpec) scriptResult {
+	families, exitCode, duration, err := runScript(s)
+	if err != nil {
+		level.Error(c.logger).Log("msg", "script failed", "script", s.Name, "duration_seconds", duration.Seconds(), "err", err)
+		return scriptResult{exitCode: exitCode, duration: duration}
+	}
+	level.Debug(c.logger).Log("msg", "script succeeded", "script", s.Name, "duration_seconds", duration.Seconds())
+	return scriptResult{families: families, success: true, exitCode: exitCode, duration: duration}
+}
+
+func runScript(s scriptSpec) (map[string]*dto.MetricFamily, int, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.Command, s.Args...)
+	cmd.Dir = s.Dir
+	cmd.Env = os.Environ()
+	for k, v := range s.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	// Don't wait forever for children that inherited stdout after the
+	// script itself was killed.
+	cmd.WaitDelay = time.Second
+	if s.User != "" {
+		cred, err := scriptCredential(s.User)
+		if err != nil {
+			return nil, -1, 0, err
+		}
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: cred}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	begin := time.Now()
+	err := cmd.Run()
+	duration := time.Since(begin)
+
+	exitCode := -1
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, exitCode, duration, fmt.Errorf("timed out after %s", s.Timeout)
+	}
+	if err != nil {
+		return nil, exitCode, duration, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(&stdout)
+	if err != nil {
+		return nil, exitCode, duration, fmt.Errorf("failed to parse script output: %w", err)
+	}
+	if hasTimestamps(families) {
+		return nil, exitCode, duration, errors.New("script output contains unsupported client-side timestamps")
+	}
+	return families, exitCode, duration, nil
+}
+
+// scriptCredential looks up the user and primary group to run a script as.
+func scriptCredential(name string) (*syscall.Credential, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid %q for user %q: %w", u.Uid, name, err)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gid %q for user %q: %w", u.Gid, name, err)
+	}
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noscript && (aix || darwin || dragonfly || freebsd || illumos || linux || netbsd || openbsd || solaris)
+// +build !noscript
+// +build aix darwin dragonfly freebsd illumos linux netbsd openbsd solaris
+
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type testScriptCollector struct {
+	sc Collector
+}
+
+func (c testScriptCollector) Collect(ch chan<- prometheus.Metric) {
+	c.sc.Update(ch)
+}
+
+func (c testScriptCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func TestScriptCollector(t *testing.T) {
+	config := `
+scripts:
+  - name: ok
+    command: /bin/sh
+    args: ["-c", "echo \"# HELP backup_age_seconds Age of the last backup.\"; echo backup_age_seconds{target=\\\"$TARGET\\\"} 42"]
+    env:
+      TARGET: db
+  - name: exit
+    command: /bin/sh
+    args: ["-c", "echo partial_metric 1; exit 3"]
+  - name: garbage
+    command: /bin/sh
+    args: ["-c", "echo 'not a metric{'"]
+  - name: timeout
+    command: /bin/sleep
+    args: ["10"]
+    timeout: 50ms
+  - name: pwd
+    command: /bin/sh
+    args: ["-c", "echo script_dir_info{dir=\\\"$(pwd)\\\"} 1"]
+    dir: /
+`
+	expected := `# HELP backup_age_seconds Age of the last backup.
+# TYPE backup_age_seconds untyped
+backup_age_seconds{target="db"} 42
+# HELP node_script_exit_code Exit code of the last run of the script, -1 if it was killed or did not start.
+# TYPE node_script_exit_code gauge
+node_script_exit_code{script="exit"} 3
+node_script_exit_code{script="garbage"} 0
+node_script_exit_code{script="ok"} 0
+node_script_exit_code{script="pwd"} 0
+node_script_exit_code{script="timeout"} -1
+# HELP node_script_success Whether the last run of the script succeeded and its output could be parsed.
+# TYPE node_script_success gauge
+node_script_success{script="exit"} 0
+node_script_success{script="garbage"} 0
+node_script_success{script="ok"} 1
+node_script_success{script="pwd"} 1
+node_script_success{script="timeout"} 0
+# HELP script_dir_info Metric read from script pwd
+# TYPE script_dir_info untyped
+script_dir_info{dir="/"} 1
+`
+	path := filepath.Join(t.TempDir(), "scripts.yml")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	*scriptConfigFile = path
+	defer func() { *scriptConfigFile = "" }()
+
+	c, err := NewScriptCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&testScriptCollector{sc: c})
+
+	err = testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"backup_age_seconds", "node_script_exit_code", "node_script_success", "partial_metric", "script_dir_info")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadScriptConfig(t *testing.T) {
+	tests := []struct {
+		config string
+		err    bool
+	}{
+		{config: "scripts:\n  - name: a\n    command: /bin/true\n"},
+		{config: "scripts:\n  - name: a\n", err: true},
+		{config: "scripts:\n  - command: /bin/true\n", err: true},
+		{config: "scripts:\n  - name: a\n    command: /bin/true\n  - name: a\n    command: /bin/false\n", err: true},
+		{config: "scripts:\n  - name: a\n    command: /bin/true\n    unknown: 1\n", err: true},
+	}
+	for i, test := range tests {
+		path := filepath.Join(t.TempDir(), "scripts.yml")
+		if err := os.WriteFile(path, []byte(test.config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		scripts, err := loadScriptConfig(path)
+		if (err != nil) != test.err {
+			t.Errorf("%d. want error %v, got %v", i, test.err, err)
+			continue
+		}
+		if err == nil && scripts[0].Timeout != defaultScriptTimeout {
+			t.Errorf("%d. want default timeout %s, got %s", i, defaultScriptTimeout, scripts[0].Timeout)
+		}
+	}
+}
+
+func TestScriptCollectorInterval(t *testing.T) {
+	dir := t.TempDir()
+	config := `
+scripts:
+  - name: counter
+    command: /bin/sh
+    args: ["-c", "n=$(($(cat runs 2>/dev/null || echo 0) + 1)); echo $n > runs; echo script_runs $n"]
+    dir: ` + dir + `
+    interval: 20ms
+`
+	path := filepath.Join(dir, "scripts.yml")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	*scriptConfigFile = path
+	defer func() { *scriptConfigFile = "" }()
+
+	c, err := NewScriptCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&testScriptCollector{sc: c})
+
+	// Scrapes return the result of the last background run, which the
+	// ticker repeats.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, mf := range mfs {
+			if mf.GetName() == "script_runs" && mf.Metric[0].GetUntyped().GetValue() >= 2 {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("script did not run repeatedly in the background")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
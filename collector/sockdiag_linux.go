@@ -0,0 +1,354 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nosockdiag
+// +build !nosockdiag
+
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+	"unsafe"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/josharian/native"
+	"github.com/mdlayher/netlink"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Socket states shared with TCP in include/net/tcp_states.h.
+	sockStateEstablished = 1
+	sockStateSynSent     = 2
+	sockStateClose       = 7
+	sockStateListen      = 10
+
+	// skMemInfoDrops is the index of SK_MEMINFO_DROPS in the
+	// INET_DIAG_SKMEMINFO attribute.
+	skMemInfoDrops = 8
+
+	sizeOfUnixDiagReq = 24
+	sizeOfUnixDiagMsg = 16
+	// Attributes requested by the show flags of unixDiagReq.
+	udiagShowName  = 0x01
+	udiagShowRQLen = 0x10
+	unixDiagName   = 0
+	unixDiagRQLen  = 4
+)
+
+var (
+	unixSocketTypes = map[uint8]string{
+		syscall.SOCK_STREAM:    "stream",
+		syscall.SOCK_DGRAM:     "dgram",
+		syscall.SOCK_SEQPACKET: "seqpacket",
+	}
+	unixSocketStates = map[uint8]string{
+		sockStateEstablished: "connected",
+		sockStateSynSent:     "connecting",
+		sockStateClose:       "unconnected",
+		sockStateListen:      "listen",
+	}
+	// sctpStates are the association states of include/net/sctp/constants.h.
+	sctpStates = []string{
+		"closed", "cookie_wait", "cookie_echoed", "established",
+		"shutdown_pending", "shutdown_sent", "shutdown_received", "shutdown_ack_sent",
+	}
+)
+
+// unixDiagReq (unix_diag_req) requests the UNIX domain sockets.
+// https://github.com/torvalds/linux/blob/v6.0/include/uapi/linux/unix_diag.h#L6
+type unixDiagReq struct {
+	Family   uint8
+	Protocol uint8
+	Pad      uint16
+	States   uint32
+	Ino      uint32
+	Show     uint32
+	Cookie   [2]uint32
+}
+
+func (req *unixDiagReq) Serialize() []byte {
+	return (*(*[sizeOfUnixDiagReq]byte)(unsafe.Pointer(req)))[:]
+}
+
+// unixDiagMsg (unix_diag_msg) describes a UNIX domain socket.
+type unixDiagMsg struct {
+	Family uint8
+	Type   uint8
+	State  uint8
+	Pad    uint8
+	Ino    uint32
+	Cookie [2]uint32
+}
+
+type sockDiagCollector struct {
+	udpSockets        typedDesc
+	udpDrops          typedDesc
+	udpBoundDrops     typedDesc
+	unixSockets       typedDesc
+	unixListenQueue   typedDesc
+	unixListenBacklog typedDesc
+	sctpAssociations  typedDesc
+	logger            log.Logger
+}
+
+func init() {
+	registerCollector("sockdiag", defaultDisabled, NewSockDiagCollector)
+}
+
+// NewSockDiagCollector returns a new Collector exposing UDP, UNIX domain and
+// SCTP socket statistics from the sock_diag netlink interface.
+func NewSockDiagCollector(logger log.Logger) (Collector, error) {
+	desc := func(subsystem, name, help string, labels ...string) typedDesc {
+		return typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, name),
+			help, labels, nil,
+		), prometheus.GaugeValue}
+	}
+	return &sockDiagCollector{
+		udpSockets:        desc("udp", "sockets", "Number of UDP sockets.", "ip"),
+		udpDrops:          desc("udp", "socket_drops", "Datagrams dropped by the current UDP sockets, mostly because their receive buffer was full.", "ip"),
+		udpBoundDrops:     desc("udp", "bound_socket_drops", "Datagrams dropped by the unconnected UDP sockets bound to the address and port, if any.", "ip", "address", "port"),
+		unixSockets:       desc("unix", "sockets", "Number of UNIX domain sockets.", "type", "state"),
+		unixListenQueue:   desc("unix", "listen_queue", "Number of connections waiting to be accepted by the listening UNIX domain socket.", "path"),
+		unixListenBacklog: desc("unix", "listen_queue_limit", "Maximum number of connections waiting to be accepted by the listening UNIX domain socket.", "path"),
+		sctpAssociations:  desc("sctp", "associations", "Number of SCTP associations.", "ip", "state"),
+		logger:            logger,
+	}, nil
+}
+
+func (c *sockDiagCollector) Update(ch chan<- prometheus.Metric) error {
+	return forEachNetNamespace(ch, c.logger, c.update)
+}
+
+func (c *sockDiagCollector) update(ch chan<- prometheus.Metric, ns netNamespace) error {
+	families := map[string]uint8{"v4": syscall.AF_INET}
+	if _, err := os.Stat(ns.procFilePath("net/if_inet6")); err == nil {
+		families["v6"] = syscall.AF_INET6
+	}
+
+	for ip, family := range families {
+		msgs, err := sockDiagDump(&InetDiagReqV2{
+			Family:   family,
+			Protocol: syscall.IPPROTO_UDP,
+			States:   tcpfAll,
+			Ext:      1 << (inetDiagSKMemInfo - 1),
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't get UDP sockets: %w", err)
+		}
+		stats, err := parseUDPDiag(msgs)
+		if err != nil {
+			return fmt.Errorf("couldn't parse UDP sockets: %w", err)
+		}
+		ch <- c.udpSockets.mustNewConstMetric(stats.sockets, ip)
+		ch <- c.udpDrops.mustNewConstMetric(stats.drops, ip)
+		for _, b := range stats.bound {
+			ch <- c.udpBoundDrops.mustNewConstMetric(b.drops, ip, b.address, b.port)
+		}
+
+		msgs, err = sockDiagDump(&InetDiagReqV2{
+			Family:   family,
+			Protocol: syscall.IPPROTO_SCTP,
+			// Endpoints are dumped only when listening sockets are requested.
+			States: tcpfAll &^ (1 << sockStateListen),
+		})
+		switch {
+		case errors.Is(err, unix.ENOENT):
+			level.Debug(c.logger).Log("msg", "SCTP socket diagnostics not available, sctp_diag probably not loaded")
+		case err != nil:
+			return fmt.Errorf("couldn't get SCTP associations: %w", err)
+		default:
+			for state, count := range parseSCTPDiag(msgs) {
+				ch <- c.sctpAssociations.mustNewConstMetric(count, ip, state)
+			}
+		}
+	}
+
+	msgs, err := sockDiagDump(&unixDiagReq{
+		Family: syscall.AF_UNIX,
+		States: 0xffffffff,
+		Show:   udiagShowName | udiagShowRQLen,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't get UNIX domain sockets: %w", err)
+	}
+	stats, err := parseUnixDiag(msgs)
+	if err != nil {
+		return fmt.Errorf("couldn't parse UNIX domain sockets: %w", err)
+	}
+	for key, count := range stats.sockets {
+		ch <- c.unixSockets.mustNewConstMetric(count, key.typ, key.state)
+	}
+	for _, l := range stats.listeners {
+		ch <- c.unixListenQueue.mustNewConstMetric(float64(l.queue), l.path)
+		ch <- c.unixListenBacklog.mustNewConstMetric(float64(l.backlog), l.path)
+	}
+	return nil
+}
+
+// udpBoundSocket are the drops of the unconnected sockets bound to an
+// address, of which there may be several with SO_REUSEPORT. Sockets without
+// drops are left out.
+type udpBoundSocket struct {
+	address string
+	port    string
+	drops   float64
+}
+
+type udpDiagStats struct {
+	sockets float64
+	drops   float64
+	bound   []*udpBoundSocket
+}
+
+func parseUDPDiag(msgs []netlink.Message) (udpDiagStats, error) {
+	var stats udpDiagStats
+	bound := map[string]*udpBoundSocket{}
+
+	for _, m := range msgs {
+		msg := parseInetDiagMsg(m.Data)
+		stats.sockets++
+		meminfo, err := inetDiagAttribute(m.Data, inetDiagSKMemInfo)
+		if err != nil {
+			return stats, err
+		}
+		if len(meminfo) < (skMemInfoDrops+1)*4 {
+			continue
+		}
+		drops := float64(native.Endian.Uint32(meminfo[skMemInfoDrops*4:]))
+		stats.drops += drops
+
+		// Connected sockets are usually short lived clients. So are many
+		// unconnected ones, such as those of resolvers on ephemeral ports,
+		// which is why only sockets that dropped datagrams are shown.
+		if msg.State != sockStateClose || msg.ID.sourcePort() == 0 || drops == 0 {
+			continue
+		}
+		address, port := msg.ID.sourceIP(msg.Family).String(), strconv.Itoa(int(msg.ID.sourcePort()))
+		key := address + " " + port
+		b, ok := bound[key]
+		if !ok {
+			b = &udpBoundSocket{address: address, port: port}
+			bound[key] = b
+			stats.bound = append(stats.bound, b)
+		}
+		b.drops += drops
+	}
+
+	return stats, nil
+}
+
+// parseSCTPDiag counts the SCTP associations by state.
+func parseSCTPDiag(msgs []netlink.Message) map[string]float64 {
+	states := map[string]float64{}
+
+	for _, m := range msgs {
+		msg := parseInetDiagMsg(m.Data)
+		state := "unknown"
+		if int(msg.State) < len(sctpStates) {
+			state = sctpStates[msg.State]
+		}
+		states[state]++
+	}
+
+	return states
+}
+
+type unixSocketKey struct {
+	typ   string
+	state string
+}
+
+// unixListener is the accept queue of a listening UNIX domain socket.
+type unixListener struct {
+	path    string
+	queue   uint32
+	backlog uint32
+}
+
+type unixDiagStats struct {
+	sockets   map[unixSocketKey]float64
+	listeners []unixListener
+}
+
+func parseUnixDiag(msgs []netlink.Message) (unixDiagStats, error) {
+	stats := unixDiagStats{sockets: map[unixSocketKey]float64{}}
+	seen := map[string]bool{}
+
+	for _, m := range msgs {
+		if len(m.Data) < sizeOfUnixDiagMsg {
+			return stats, fmt.Errorf("short unix_diag message of %d bytes", len(m.Data))
+		}
+		msg := (*unixDiagMsg)(unsafe.Pointer(&m.Data[0]))
+		key := unixSocketKey{typ: unixSocketTypes[msg.Type], state: unixSocketStates[msg.State]}
+		if key.typ == "" {
+			key.typ = "unknown"
+		}
+		if key.state == "" {
+			key.state = "unknown"
+		}
+		stats.sockets[key]++
+
+		if msg.State != sockStateListen {
+			continue
+		}
+		l, err := parseUnixListener(m.Data[sizeOfUnixDiagMsg:])
+		if err != nil {
+			return stats, err
+		}
+		// Unnamed listeners can't be told apart.
+		if l.path == "" || seen[l.path] {
+			continue
+		}
+		seen[l.path] = true
+		stats.listeners = append(stats.listeners, l)
+	}
+
+	return stats, nil
+}
+
+func parseUnixListener(attrs []byte) (unixListener, error) {
+	var l unixListener
+	ad, err := netlink.NewAttributeDecoder(attrs)
+	if err != nil {
+		return l, fmt.Errorf("invalid unix_diag attributes: %w", err)
+	}
+	for ad.Next() {
+		switch ad.Type() {
+		case unixDiagName:
+			name := ad.Bytes()
+			// Abstract socket names start with a NUL byte, shown as @ like
+			// ss and netstat do.
+			if len(name) > 0 && name[0] == 0 {
+				name = append([]byte{'@'}, name[1:]...)
+			}
+			l.path = string(bytes.TrimRight(name, "\x00"))
+		case unixDiagRQLen:
+			b := ad.Bytes()
+			if len(b) < 8 {
+				return l, fmt.Errorf("short UNIX_DIAG_RQLEN attribute of %d bytes", len(b))
+			}
+			l.queue = native.Endian.Uint32(b)
+			l.backlog = native.Endian.Uint32(b[4:])
+		}
+	}
+	return l, ad.Err()
+}
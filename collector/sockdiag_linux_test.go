@@ -0,0 +1,144 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nosockdiag
+// +build !nosockdiag
+
+package collector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/josharian/native"
+	"github.com/mdlayher/netlink"
+)
+
+// encodeSockDiagMsg encodes a sock_diag message header followed by the
+// attributes.
+func encodeSockDiagMsg(t *testing.T, header interface{}, encode func(ae *netlink.AttributeEncoder)) netlink.Message {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, native.Endian, header); err != nil {
+		t.Fatal(err)
+	}
+	if encode != nil {
+		ae := netlink.NewAttributeEncoder()
+		encode(ae)
+		attrs, err := ae.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(attrs)
+	}
+	return netlink.Message{Data: buf.Bytes()}
+}
+
+func udpDiagMsg(t *testing.T, state uint8, srcIP net.IP, srcPort uint16, drops uint32) netlink.Message {
+	msg := InetDiagMsg{Family: syscall.AF_INET, State: state}
+	binary.BigEndian.PutUint16(msg.ID.SourcePort[:], srcPort)
+	copy(msg.ID.SourceIP[0][:], srcIP.To4())
+	meminfo := make([]byte, (skMemInfoDrops+1)*4)
+	native.Endian.PutUint32(meminfo[skMemInfoDrops*4:], drops)
+	return encodeSockDiagMsg(t, msg, func(ae *netlink.AttributeEncoder) {
+		ae.Bytes(inetDiagSKMemInfo, meminfo)
+	})
+}
+
+func Test_parseUDPDiag(t *testing.T) {
+	msgs := []netlink.Message{
+		// Two SO_REUSEPORT sockets bound to the same address.
+		udpDiagMsg(t, sockStateClose, net.ParseIP("0.0.0.0"), 53, 3),
+		udpDiagMsg(t, sockStateClose, net.ParseIP("0.0.0.0"), 53, 4),
+		udpDiagMsg(t, sockStateClose, net.ParseIP("127.0.0.1"), 323, 0),
+		// A connected client socket.
+		udpDiagMsg(t, sockStateEstablished, net.ParseIP("10.0.0.1"), 40000, 1),
+	}
+
+	stats, err := parseUDPDiag(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 4.0, stats.sockets; want != got {
+		t.Errorf("want sockets %v, got %v", want, got)
+	}
+	if want, got := 8.0, stats.drops; want != got {
+		t.Errorf("want drops %v, got %v", want, got)
+	}
+	// The socket without drops is left out.
+	want := []*udpBoundSocket{
+		{address: "0.0.0.0", port: "53", drops: 7},
+	}
+	if !reflect.DeepEqual(want, stats.bound) {
+		t.Errorf("want bound sockets %+v, got %+v", want, stats.bound)
+	}
+}
+
+func Test_parseSCTPDiag(t *testing.T) {
+	msgs := []netlink.Message{
+		encodeSockDiagMsg(t, InetDiagMsg{Family: syscall.AF_INET, State: 3}, nil),
+		encodeSockDiagMsg(t, InetDiagMsg{Family: syscall.AF_INET, State: 3}, nil),
+		encodeSockDiagMsg(t, InetDiagMsg{Family: syscall.AF_INET, State: 1}, nil),
+		encodeSockDiagMsg(t, InetDiagMsg{Family: syscall.AF_INET, State: 42}, nil),
+	}
+
+	want := map[string]float64{"established": 2, "cookie_wait": 1, "unknown": 1}
+	if got := parseSCTPDiag(msgs); !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func Test_parseUnixDiag(t *testing.T) {
+	listener := func(typ uint8, name string, queue, backlog uint32) netlink.Message {
+		return encodeSockDiagMsg(t, unixDiagMsg{Family: syscall.AF_UNIX, Type: typ, State: sockStateListen}, func(ae *netlink.AttributeEncoder) {
+			if name != "" {
+				ae.Bytes(unixDiagName, []byte(name))
+			}
+			rqlen := make([]byte, 8)
+			native.Endian.PutUint32(rqlen, queue)
+			native.Endian.PutUint32(rqlen[4:], backlog)
+			ae.Bytes(unixDiagRQLen, rqlen)
+		})
+	}
+	msgs := []netlink.Message{
+		listener(syscall.SOCK_STREAM, "/run/docker.sock", 2, 4096),
+		listener(syscall.SOCK_SEQPACKET, "\x00abstract", 0, 128),
+		listener(syscall.SOCK_STREAM, "", 0, 128),
+		encodeSockDiagMsg(t, unixDiagMsg{Family: syscall.AF_UNIX, Type: syscall.SOCK_STREAM, State: sockStateEstablished}, nil),
+		encodeSockDiagMsg(t, unixDiagMsg{Family: syscall.AF_UNIX, Type: syscall.SOCK_DGRAM, State: sockStateClose}, nil),
+	}
+
+	stats, err := parseUnixDiag(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSockets := map[unixSocketKey]float64{
+		{typ: "stream", state: "listen"}:     2,
+		{typ: "seqpacket", state: "listen"}:  1,
+		{typ: "stream", state: "connected"}:  1,
+		{typ: "dgram", state: "unconnected"}: 1,
+	}
+	if !reflect.DeepEqual(wantSockets, stats.sockets) {
+		t.Errorf("want sockets %v, got %v", wantSockets, stats.sockets)
+	}
+	wantListeners := []unixListener{
+		{path: "/run/docker.sock", queue: 2, backlog: 4096},
+		{path: "@abstract", queue: 0, backlog: 128},
+	}
+	if !reflect.DeepEqual(wantListeners, stats.listeners) {
+		t.Errorf("want listeners %+v, got %+v", wantListeners, stats.listeners)
+	}
+}
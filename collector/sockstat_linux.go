@@ -48,7 +48,11 @@ func NewSockStatCollector(logger log.Logger) (Collector, error) {
 }
 
 func (c *sockStatCollector) Update(ch chan<- prometheus.Metric) error {
-	fs, err := procfs.NewFS(*procPath)
+	return forEachNetNamespace(ch, c.logger, c.updateNetNamespace)
+}
+
+func (c *sockStatCollector) updateNetNamespace(ch chan<- prometheus.Metric, ns netNamespace) error {
+	fs, err := ns.procFS()
 	if err != nil {
 		return fmt.Errorf("failed to open procfs: %w", err)
 	}
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
@@ -53,11 +54,13 @@ var (
 		systemdUnitExcludeSet = true
 		return nil
 	}).String()
-	oldSystemdUnitExclude  = kingpin.Flag("collector.systemd.unit-blacklist", "DEPRECATED: Use collector.systemd.unit-exclude").Hidden().String()
-	systemdPrivate         = kingpin.Flag("collector.systemd.private", "Establish a private, direct connection to systemd without dbus (Strongly discouraged since it requires root. For testing purposes only).").Hidden().Bool()
-	enableTaskMetrics      = kingpin.Flag("collector.systemd.enable-task-metrics", "Enables service unit tasks metrics unit_tasks_current and unit_tasks_max").Bool()
-	enableRestartsMetrics  = kingpin.Flag("collector.systemd.enable-restarts-metrics", "Enables service unit metric service_restart_total").Bool()
-	enableStartTimeMetrics = kingpin.Flag("collector.systemd.enable-start-time-metrics", "Enables service unit metric unit_start_time_seconds").Bool()
+	oldSystemdUnitExclude   = kingpin.Flag("collector.systemd.unit-blacklist", "DEPRECATED: Use collector.systemd.unit-exclude").Hidden().String()
+	systemdPrivate          = kingpin.Flag("collector.systemd.private", "Establish a private, direct connection to systemd without dbus (Strongly discouraged since it requires root. For testing purposes only).").Hidden().Bool()
+	enableTaskMetrics       = kingpin.Flag("collector.systemd.enable-task-metrics", "Enables service unit tasks metrics unit_tasks_current and unit_tasks_max").Bool()
+	enableRestartsMetrics   = kingpin.Flag("collector.systemd.enable-restarts-metrics", "Enables service unit metric service_restart_total").Bool()
+	enableStartTimeMetrics  = kingpin.Flag("collector.systemd.enable-start-time-metrics", "Enables service unit metric unit_start_time_seconds").Bool()
+	enableAccountingMetrics = kingpin.Flag("collector.systemd.enable-accounting-metrics", "Enables unit resource accounting metrics unit_cpu_seconds_total, unit_memory_bytes, unit_memory_peak_bytes, unit_io_*_bytes_total and unit_ip_*_bytes_total").Bool()
+	systemdWatch            = kingpin.Flag("collector.systemd.watch", "Track units through the signals of systemd instead of listing them on every scrape. Enables unit_state_changes_total").Bool()
 
 	systemdVersionRE = regexp.MustCompile(`[0-9]{3,}(\.[0-9]+)?`)
 )
@@ -68,6 +71,10 @@ type systemdCollector struct {
 	unitTasksCurrentDesc          *prometheus.Desc
 	unitTasksMaxDesc              *prometheus.Desc
 	systemRunningDesc             *prometheus.Desc
+	bootStageDurationDesc         *prometheus.Desc
+	bootDurationDesc              *prometheus.Desc
+	unitResultDesc                *prometheus.Desc
+	execMainStatusDesc            *prometheus.Desc
 	summaryDesc                   *prometheus.Desc
 	nRestartsDesc                 *prometheus.Desc
 	timerLastTriggerDesc          *prometheus.Desc
@@ -75,14 +82,51 @@ type systemdCollector struct {
 	socketCurrentConnectionsDesc  *prometheus.Desc
 	socketRefusedConnectionsDesc  *prometheus.Desc
 	systemdVersionDesc            *prometheus.Desc
+	unitStateChangesDesc          *prometheus.Desc
+	// Resource accounting descriptors by D-Bus property name.
+	unitAccountingDescs map[string]unitAccountingDesc
 	// Use regexps for more flexability than device_filter.go allows
 	systemdUnitIncludePattern *regexp.Regexp
 	systemdUnitExcludePattern *regexp.Regexp
-	logger                    log.Logger
+	// Unit cache kept up to date from systemd signals, nil unless watching.
+	watcher *systemdUnitWatcher
+	logger  log.Logger
 }
 
 var unitStatesName = []string{"active", "activating", "deactivating", "inactive", "failed"}
 
+// unitAccountingDesc maps a resource accounting property of a unit to a
+// metric, dividing the value by divisor.
+type unitAccountingDesc struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	divisor   float64
+}
+
+// unitResultTypes maps the suffixes of the unit types that have a Result
+// property to their D-Bus interface names.
+var unitResultTypes = map[string]string{
+	".automount": "Automount",
+	".mount":     "Mount",
+	".path":      "Path",
+	".scope":     "Scope",
+	".service":   "Service",
+	".socket":    "Socket",
+	".swap":      "Swap",
+	".timer":     "Timer",
+}
+
+// unitAccountingTypes maps the suffixes of the unit types that have a cgroup
+// and thus resource accounting to their D-Bus interface names.
+var unitAccountingTypes = map[string]string{
+	".mount":   "Mount",
+	".scope":   "Scope",
+	".service": "Service",
+	".slice":   "Slice",
+	".socket":  "Socket",
+	".swap":    "Swap",
+}
+
 func init() {
 	registerCollector("systemd", defaultDisabled, NewSystemdCollector)
 }
@@ -112,6 +156,26 @@ func NewSystemdCollector(logger log.Logger) (Collector, error) {
 		"Whether the system is operational (see 'systemctl is-system-running')",
 		nil, nil,
 	)
+	bootStageDurationDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "boot_stage_duration_seconds"),
+		"Time spent in each stage of the last boot (see 'systemd-analyze time').",
+		[]string{"stage"}, nil,
+	)
+	bootDurationDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "boot_duration_seconds"),
+		"Time from firmware start until the last boot finished.",
+		nil, nil,
+	)
+	unitResultDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "unit_result"),
+		"Result of failed units, such as exit-code, timeout, oom-kill or watchdog.",
+		[]string{"name", "result"}, nil,
+	)
+	execMainStatusDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "service_exec_main_status"),
+		"Exit status, or number of the terminating signal, of the main process of failed service units.",
+		[]string{"name"}, nil,
+	)
 	summaryDesc := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, subsystem, "units"),
 		"Summary of systemd unit states", []string{"state"}, nil)
@@ -133,6 +197,25 @@ func NewSystemdCollector(logger log.Logger) (Collector, error) {
 	systemdVersionDesc := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, subsystem, "version"),
 		"Detected systemd version", []string{"version"}, nil)
+	unitStateChangesDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "unit_state_changes_total"),
+		"Number of changes of the active state of the unit since it was first seen.", []string{"name"}, nil)
+
+	accountingDesc := func(name, help string, valueType prometheus.ValueType, divisor float64) unitAccountingDesc {
+		return unitAccountingDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, name),
+			help, []string{"name"}, nil,
+		), valueType, divisor}
+	}
+	unitAccountingDescs := map[string]unitAccountingDesc{
+		"CPUUsageNSec":   accountingDesc("unit_cpu_seconds_total", "CPU time consumed by the unit.", prometheus.CounterValue, 1e9),
+		"MemoryCurrent":  accountingDesc("unit_memory_bytes", "Memory currently used by the unit.", prometheus.GaugeValue, 1),
+		"MemoryPeak":     accountingDesc("unit_memory_peak_bytes", "Peak memory usage of the unit.", prometheus.GaugeValue, 1),
+		"IOReadBytes":    accountingDesc("unit_io_read_bytes_total", "Bytes read from block devices by the unit.", prometheus.CounterValue, 1),
+		"IOWriteBytes":   accountingDesc("unit_io_written_bytes_total", "Bytes written to block devices by the unit.", prometheus.CounterValue, 1),
+		"IPIngressBytes": accountingDesc("unit_ip_ingress_bytes_total", "IP bytes received by the unit.", prometheus.CounterValue, 1),
+		"IPEgressBytes":  accountingDesc("unit_ip_egress_bytes_total", "IP bytes sent by the unit.", prometheus.CounterValue, 1),
+	}
 
 	if *oldSystemdUnitExclude != "" {
 		if !systemdUnitExcludeSet {
@@ -155,12 +238,22 @@ func NewSystemdCollector(logger log.Logger) (Collector, error) {
 	level.Info(logger).Log("msg", "Parsed flag --collector.systemd.unit-exclude", "flag", *systemdUnitExclude)
 	systemdUnitExcludePattern := regexp.MustCompile(fmt.Sprintf("^(?:%s)$", *systemdUnitExclude))
 
+	var watcher *systemdUnitWatcher
+	if *systemdWatch {
+		watcher = newSystemdUnitWatcher(logger)
+		go watcher.run()
+	}
+
 	return &systemdCollector{
 		unitDesc:                      unitDesc,
 		unitStartTimeDesc:             unitStartTimeDesc,
 		unitTasksCurrentDesc:          unitTasksCurrentDesc,
 		unitTasksMaxDesc:              unitTasksMaxDesc,
 		systemRunningDesc:             systemRunningDesc,
+		bootStageDurationDesc:         bootStageDurationDesc,
+		bootDurationDesc:              bootDurationDesc,
+		unitResultDesc:                unitResultDesc,
+		execMainStatusDesc:            execMainStatusDesc,
 		summaryDesc:                   summaryDesc,
 		nRestartsDesc:                 nRestartsDesc,
 		timerLastTriggerDesc:          timerLastTriggerDesc,
@@ -168,8 +261,11 @@ func NewSystemdCollector(logger log.Logger) (Collector, error) {
 		socketCurrentConnectionsDesc:  socketCurrentConnectionsDesc,
 		socketRefusedConnectionsDesc:  socketRefusedConnectionsDesc,
 		systemdVersionDesc:            systemdVersionDesc,
+		unitStateChangesDesc:          unitStateChangesDesc,
+		unitAccountingDescs:           unitAccountingDescs,
 		systemdUnitIncludePattern:     systemdUnitIncludePattern,
 		systemdUnitExcludePattern:     systemdUnitExcludePattern,
+		watcher:                       watcher,
 		logger:                        logger,
 	}, nil
 }
@@ -195,11 +291,24 @@ func (c *systemdCollector) Update(ch chan<- prometheus.Metric) error {
 		systemdVersionFull,
 	)
 
-	allUnits, err := c.getAllUnits(conn)
-	if err != nil {
-		return fmt.Errorf("couldn't get units: %w", err)
+	var (
+		allUnits     []unit
+		stateChanges map[string]uint64
+		watched      bool
+	)
+	if c.watcher != nil {
+		allUnits, stateChanges, watched = c.watcher.snapshot()
+		if !watched {
+			level.Debug(c.logger).Log("msg", "systemd units are not watched yet, listing them")
+		}
+	}
+	if !watched {
+		allUnits, err = c.getAllUnits(conn)
+		if err != nil {
+			return fmt.Errorf("couldn't get units: %w", err)
+		}
+		level.Debug(c.logger).Log("msg", "getAllUnits took", "duration_seconds", time.Since(begin).Seconds())
 	}
-	level.Debug(c.logger).Log("msg", "getAllUnits took", "duration_seconds", time.Since(begin).Seconds())
 
 	begin = time.Now()
 	summary := summarizeUnits(allUnits)
@@ -210,6 +319,10 @@ func (c *systemdCollector) Update(ch chan<- prometheus.Metric) error {
 	units := filterUnits(allUnits, c.systemdUnitIncludePattern, c.systemdUnitExcludePattern, c.logger)
 	level.Debug(c.logger).Log("msg", "filterUnits took", "duration_seconds", time.Since(begin).Seconds())
 
+	if watched {
+		c.collectUnitStateChanges(ch, units, stateChanges)
+	}
+
 	var wg sync.WaitGroup
 	defer wg.Wait()
 
@@ -241,6 +354,16 @@ func (c *systemdCollector) Update(ch chan<- prometheus.Metric) error {
 		}()
 	}
 
+	if *enableAccountingMetrics {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			begin = time.Now()
+			c.collectUnitAccountingMetrics(conn, ch, units)
+			level.Debug(c.logger).Log("msg", "collectUnitAccountingMetrics took", "duration_seconds", time.Since(begin).Seconds())
+		}()
+	}
+
 	if systemdVersion >= minSystemdVersionSystemState {
 		wg.Add(1)
 		go func() {
@@ -272,19 +395,9 @@ func (c *systemdCollector) collectUnitStatusMetrics(conn *dbus.Conn, ch chan<- p
 	for _, unit := range units {
 		serviceType := ""
 		if strings.HasSuffix(unit.Name, ".service") {
-			serviceTypeProperty, err := conn.GetUnitTypePropertyContext(context.TODO(), unit.Name, "Service", "Type")
-			if err != nil {
-				level.Debug(c.logger).Log("msg", "couldn't get unit type", "unit", unit.Name, "err", err)
-			} else {
-				serviceType = serviceTypeProperty.Value.Value().(string)
-			}
+			serviceType = c.getUnitType(conn, unit.Name, "Service")
 		} else if strings.HasSuffix(unit.Name, ".mount") {
-			serviceTypeProperty, err := conn.GetUnitTypePropertyContext(context.TODO(), unit.Name, "Mount", "Type")
-			if err != nil {
-				level.Debug(c.logger).Log("msg", "couldn't get unit type", "unit", unit.Name, "err", err)
-			} else {
-				serviceType = serviceTypeProperty.Value.Value().(string)
-			}
+			serviceType = c.getUnitType(conn, unit.Name, "Mount")
 		}
 		for _, stateName := range unitStatesName {
 			isActive := 0.0
@@ -295,6 +408,9 @@ func (c *systemdCollector) collectUnitStatusMetrics(conn *dbus.Conn, ch chan<- p
 				c.unitDesc, prometheus.GaugeValue, isActive,
 				unit.Name, stateName, serviceType)
 		}
+		if unit.ActiveState == "failed" {
+			c.collectUnitFailure(conn, ch, unit.Name)
+		}
 		if *enableRestartsMetrics && strings.HasSuffix(unit.Name, ".service") {
 			// NRestarts wasn't added until systemd 235.
 			restartsCount, err := conn.GetUnitTypePropertyContext(context.TODO(), unit.Name, "Service", "NRestarts")
@@ -309,6 +425,61 @@ func (c *systemdCollector) collectUnitStatusMetrics(conn *dbus.Conn, ch chan<- p
 	}
 }
 
+// collectUnitFailure exposes why a failed unit failed.
+func (c *systemdCollector) collectUnitFailure(conn *dbus.Conn, ch chan<- prometheus.Metric, name string) {
+	unitType, ok := unitResultTypes[path.Ext(name)]
+	if !ok {
+		return
+	}
+	result, err := conn.GetUnitTypePropertyContext(context.TODO(), name, unitType, "Result")
+	if err != nil {
+		level.Debug(c.logger).Log("msg", "couldn't get unit Result", "unit", name, "err", err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(
+			c.unitResultDesc, prometheus.GaugeValue, 1,
+			name, result.Value.Value().(string))
+	}
+	if unitType != "Service" {
+		return
+	}
+	status, err := conn.GetUnitTypePropertyContext(context.TODO(), name, unitType, "ExecMainStatus")
+	if err != nil {
+		level.Debug(c.logger).Log("msg", "couldn't get unit ExecMainStatus", "unit", name, "err", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		c.execMainStatusDesc, prometheus.GaugeValue,
+		float64(status.Value.Value().(int32)), name)
+}
+
+// getUnitType returns the Type property of a service or mount unit, which is
+// cached when watching the units.
+func (c *systemdCollector) getUnitType(conn *dbus.Conn, name, unitType string) string {
+	if c.watcher != nil {
+		if t, ok := c.watcher.unitType(name); ok {
+			return t
+		}
+	}
+	typeProperty, err := conn.GetUnitTypePropertyContext(context.TODO(), name, unitType, "Type")
+	if err != nil {
+		level.Debug(c.logger).Log("msg", "couldn't get unit type", "unit", name, "err", err)
+		return ""
+	}
+	t := typeProperty.Value.Value().(string)
+	if c.watcher != nil {
+		c.watcher.setUnitType(name, t)
+	}
+	return t
+}
+
+func (c *systemdCollector) collectUnitStateChanges(ch chan<- prometheus.Metric, units []unit, stateChanges map[string]uint64) {
+	for _, unit := range units {
+		ch <- prometheus.MustNewConstMetric(
+			c.unitStateChangesDesc, prometheus.CounterValue,
+			float64(stateChanges[unit.Name]), unit.Name)
+	}
+}
+
 func (c *systemdCollector) collectSockets(conn *dbus.Conn, ch chan<- prometheus.Metric, units []unit) {
 	for _, unit := range units {
 		if !strings.HasSuffix(unit.Name, ".socket") {
@@ -396,6 +567,35 @@ func (c *systemdCollector) collectUnitTasksMetrics(conn *dbus.Conn, ch chan<- pr
 	}
 }
 
+func (c *systemdCollector) collectUnitAccountingMetrics(conn *dbus.Conn, ch chan<- prometheus.Metric, units []unit) {
+	for _, unit := range units {
+		unitType, ok := unitAccountingTypes[path.Ext(unit.Name)]
+		if !ok {
+			continue
+		}
+		// Fetch all properties at once instead of one round trip each.
+		properties, err := conn.GetUnitTypePropertiesContext(context.TODO(), unit.Name, unitType)
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't get unit properties", "unit", unit.Name, "err", err)
+			continue
+		}
+		c.exportUnitAccounting(ch, unit.Name, properties)
+	}
+}
+
+// exportUnitAccounting exposes the resource accounting properties of a unit.
+// Properties are missing in older systemd versions, and systemd reports
+// MaxUint64 if accounting is disabled for the unit.
+func (c *systemdCollector) exportUnitAccounting(ch chan<- prometheus.Metric, name string, properties map[string]interface{}) {
+	for property, d := range c.unitAccountingDescs {
+		value, ok := properties[property].(uint64)
+		if !ok || value == math.MaxUint64 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(d.desc, d.valueType, float64(value)/d.divisor, name)
+	}
+}
+
 func (c *systemdCollector) collectTimers(conn *dbus.Conn, ch chan<- prometheus.Metric, units []unit) {
 	for _, unit := range units {
 		if !strings.HasSuffix(unit.Name, ".timer") {
@@ -431,9 +631,79 @@ func (c *systemdCollector) collectSystemState(conn *dbus.Conn, ch chan<- prometh
 		isSystemRunning = 1.0
 	}
 	ch <- prometheus.MustNewConstMetric(c.systemRunningDesc, prometheus.GaugeValue, isSystemRunning)
+
+	timestamps := map[string]uint64{}
+	for _, property := range bootTimestampProperties {
+		timestamp, err := getManagerUint64Property(conn, property)
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't get boot timestamp", "property", property, "err", err)
+			return nil
+		}
+		timestamps[property] = timestamp
+	}
+	c.exportBootDurations(ch, timestamps)
 	return nil
 }
 
+// bootTimestampProperties are the manager properties holding the monotonic
+// timestamps of the boot stages, in microseconds. The firmware and loader
+// timestamps count back from the start of the kernel.
+var bootTimestampProperties = []string{
+	"FirmwareTimestampMonotonic",
+	"LoaderTimestampMonotonic",
+	"KernelTimestampMonotonic",
+	"InitRDTimestampMonotonic",
+	"UserspaceTimestampMonotonic",
+	"FinishTimestampMonotonic",
+}
+
+// exportBootDurations exposes the boot stage durations the way
+// systemd-analyze computes them. Stages that didn't happen, such as the
+// firmware on machines without EFI, are left out. Nothing but the kernel and
+// initrd durations is known until the boot has finished.
+func (c *systemdCollector) exportBootDurations(ch chan<- prometheus.Metric, timestamps map[string]uint64) {
+	var (
+		firmware  = timestamps["FirmwareTimestampMonotonic"]
+		loader    = timestamps["LoaderTimestampMonotonic"]
+		kernel    = timestamps["KernelTimestampMonotonic"]
+		initrd    = timestamps["InitRDTimestampMonotonic"]
+		userspace = timestamps["UserspaceTimestampMonotonic"]
+		finish    = timestamps["FinishTimestampMonotonic"]
+	)
+	stage := func(name string, usec uint64) {
+		ch <- prometheus.MustNewConstMetric(c.bootStageDurationDesc, prometheus.GaugeValue, float64(usec)/1e6, name)
+	}
+	if firmware > 0 && firmware >= loader {
+		stage("firmware", firmware-loader)
+	}
+	if loader > 0 {
+		stage("loader", loader)
+	}
+	if initrd > 0 {
+		stage("kernel", initrd-kernel)
+		if userspace >= initrd {
+			stage("initrd", userspace-initrd)
+		}
+	} else if userspace > 0 {
+		stage("kernel", userspace-kernel)
+	}
+	if finish == 0 || finish < userspace {
+		return
+	}
+	stage("userspace", finish-userspace)
+	ch <- prometheus.MustNewConstMetric(c.bootDurationDesc, prometheus.GaugeValue, float64(firmware+finish-kernel)/1e6)
+}
+
+// getManagerUint64Property returns a numeric manager property, which
+// GetManagerProperty formats like "@t 1234".
+func getManagerUint64Property(conn *dbus.Conn, name string) (uint64, error) {
+	value, err := conn.GetManagerProperty(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimPrefix(value, "@t "), 10, 64)
+}
+
 func newSystemdDbusConn() (*dbus.Conn, error) {
 	if *systemdPrivate {
 		return dbus.NewSystemdConnectionContext(context.TODO())
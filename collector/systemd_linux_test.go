@@ -17,11 +17,16 @@
 package collector
 
 import (
+	"math"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/coreos/go-systemd/v22/dbus"
 	"github.com/go-kit/log"
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 // Creates mock UnitLists
@@ -136,3 +141,198 @@ func testSummaryHelper(t *testing.T, state string, actual float64, expected floa
 		t.Errorf("Summary mode didn't count %s jobs correctly. Actual: %f, expected: %f", state, actual, expected)
 	}
 }
+
+type testSystemdAccountingCollector struct {
+	c          *systemdCollector
+	properties map[string]interface{}
+}
+
+func (c testSystemdAccountingCollector) Collect(ch chan<- prometheus.Metric) {
+	c.c.exportUnitAccounting(ch, "foo.service", c.properties)
+}
+
+func (c testSystemdAccountingCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func TestSystemdUnitAccounting(t *testing.T) {
+	c, err := NewSystemdCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties := map[string]interface{}{
+		"CPUUsageNSec":   uint64(2500000000),
+		"MemoryCurrent":  uint64(8974336),
+		"MemoryPeak":     uint64(12845056),
+		"IOReadBytes":    uint64(18632704),
+		"IOWriteBytes":   uint64(4096),
+		"IPIngressBytes": uint64(math.MaxUint64),
+		"TasksCurrent":   uint64(3),
+	}
+	expected := `# HELP node_systemd_unit_cpu_seconds_total CPU time consumed by the unit.
+# TYPE node_systemd_unit_cpu_seconds_total counter
+node_systemd_unit_cpu_seconds_total{name="foo.service"} 2.5
+# HELP node_systemd_unit_io_read_bytes_total Bytes read from block devices by the unit.
+# TYPE node_systemd_unit_io_read_bytes_total counter
+node_systemd_unit_io_read_bytes_total{name="foo.service"} 1.8632704e+07
+# HELP node_systemd_unit_io_written_bytes_total Bytes written to block devices by the unit.
+# TYPE node_systemd_unit_io_written_bytes_total counter
+node_systemd_unit_io_written_bytes_total{name="foo.service"} 4096
+# HELP node_systemd_unit_memory_bytes Memory currently used by the unit.
+# TYPE node_systemd_unit_memory_bytes gauge
+node_systemd_unit_memory_bytes{name="foo.service"} 8.974336e+06
+# HELP node_systemd_unit_memory_peak_bytes Peak memory usage of the unit.
+# TYPE node_systemd_unit_memory_peak_bytes gauge
+node_systemd_unit_memory_peak_bytes{name="foo.service"} 1.2845056e+07
+`
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(testSystemdAccountingCollector{c: c.(*systemdCollector), properties: properties})
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSystemdUnitWatcher(t *testing.T) {
+	w := newSystemdUnitWatcher(log.NewNopLogger())
+	if _, _, ok := w.snapshot(); ok {
+		t.Fatal("unsynced watcher returned units")
+	}
+	w.reset([]dbus.UnitStatus{
+		{Name: "foo.service", LoadState: "loaded", ActiveState: "active", SubState: "running", Path: "/org/freedesktop/systemd1/unit/foo_2eservice"},
+		{Name: "bar.service", LoadState: "loaded", ActiveState: "inactive", SubState: "dead", Path: "/org/freedesktop/systemd1/unit/bar_2eservice"},
+	})
+
+	changed := func(path godbus.ObjectPath, activeState, subState string) *godbus.Signal {
+		return &godbus.Signal{
+			Path: path,
+			Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+			Body: []interface{}{
+				"org.freedesktop.systemd1.Unit",
+				map[string]godbus.Variant{
+					"ActiveState": godbus.MakeVariant(activeState),
+					"SubState":    godbus.MakeVariant(subState),
+				},
+				[]string{},
+			},
+		}
+	}
+	for _, signal := range []*godbus.Signal{
+		// foo.service restarts twice between scrapes.
+		changed("/org/freedesktop/systemd1/unit/foo_2eservice", "deactivating", "stop-sigterm"),
+		changed("/org/freedesktop/systemd1/unit/foo_2eservice", "activating", "start"),
+		changed("/org/freedesktop/systemd1/unit/foo_2eservice", "active", "running"),
+		changed("/org/freedesktop/systemd1/unit/foo_2eservice", "failed", "failed"),
+		// Only the sub state of bar.service changes.
+		changed("/org/freedesktop/systemd1/unit/bar_2eservice", "inactive", "dead"),
+		{
+			Name: "org.freedesktop.systemd1.Manager.UnitNew",
+			Body: []interface{}{"baz-1.scope", godbus.ObjectPath("/org/freedesktop/systemd1/unit/baz_2d1_2escope")},
+		},
+		changed("/org/freedesktop/systemd1/unit/baz_2d1_2escope", "active", "running"),
+		{
+			Name: "org.freedesktop.systemd1.Manager.UnitRemoved",
+			Body: []interface{}{"bar.service", godbus.ObjectPath("/org/freedesktop/systemd1/unit/bar_2eservice")},
+		},
+		// Only loaded units are reported.
+		{
+			Name: "org.freedesktop.systemd1.Manager.UnitNew",
+			Body: []interface{}{"qux.service", godbus.ObjectPath("/org/freedesktop/systemd1/unit/qux_2eservice")},
+		},
+	} {
+		w.handleSignal(signal)
+	}
+
+	units, stateChanges, ok := w.snapshot()
+	if !ok {
+		t.Fatal("synced watcher returned no units")
+	}
+	expected := []struct {
+		name, activeState, subState string
+		stateChanges                uint64
+	}{
+		{"baz-1.scope", "active", "running", 0},
+		{"foo.service", "failed", "failed", 4},
+	}
+	if len(units) != len(expected) {
+		t.Fatalf("expected %d units, got %v", len(expected), units)
+	}
+	for i, e := range expected {
+		u := units[i]
+		if u.Name != e.name || u.ActiveState != e.activeState || u.SubState != e.subState || stateChanges[u.Name] != e.stateChanges {
+			t.Errorf("expected %+v, got %+v with %d state changes", e, u.UnitStatus, stateChanges[u.Name])
+		}
+	}
+
+	// A unit that changed state while disconnected counts as changed once.
+	w.reset([]dbus.UnitStatus{{Name: "foo.service", LoadState: "loaded", ActiveState: "active", SubState: "running"}})
+	if _, stateChanges, _ := w.snapshot(); stateChanges["foo.service"] != 5 {
+		t.Errorf("expected 5 state changes after resync, got %d", stateChanges["foo.service"])
+	}
+}
+
+type testSystemdBootCollector struct {
+	c          *systemdCollector
+	timestamps map[string]uint64
+}
+
+func (c testSystemdBootCollector) Collect(ch chan<- prometheus.Metric) {
+	c.c.exportBootDurations(ch, c.timestamps)
+}
+
+func (c testSystemdBootCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func TestSystemdBootDurations(t *testing.T) {
+	c, err := NewSystemdCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name       string
+		timestamps map[string]uint64
+		expected   string
+	}{
+		{
+			name: "efi with initrd",
+			timestamps: map[string]uint64{
+				"FirmwareTimestampMonotonic":  9810000,
+				"LoaderTimestampMonotonic":    2150000,
+				"KernelTimestampMonotonic":    0,
+				"InitRDTimestampMonotonic":    1830000,
+				"UserspaceTimestampMonotonic": 4520000,
+				"FinishTimestampMonotonic":    12270000,
+			},
+			expected: `# HELP node_systemd_boot_duration_seconds Time from firmware start until the last boot finished.
+# TYPE node_systemd_boot_duration_seconds gauge
+node_systemd_boot_duration_seconds 22.08
+# HELP node_systemd_boot_stage_duration_seconds Time spent in each stage of the last boot (see 'systemd-analyze time').
+# TYPE node_systemd_boot_stage_duration_seconds gauge
+node_systemd_boot_stage_duration_seconds{stage="firmware"} 7.66
+node_systemd_boot_stage_duration_seconds{stage="initrd"} 2.69
+node_systemd_boot_stage_duration_seconds{stage="kernel"} 1.83
+node_systemd_boot_stage_duration_seconds{stage="loader"} 2.15
+node_systemd_boot_stage_duration_seconds{stage="userspace"} 7.75
+`,
+		},
+		{
+			name: "still booting",
+			timestamps: map[string]uint64{
+				"KernelTimestampMonotonic":    0,
+				"UserspaceTimestampMonotonic": 1250000,
+			},
+			expected: `# HELP node_systemd_boot_stage_duration_seconds Time spent in each stage of the last boot (see 'systemd-analyze time').
+# TYPE node_systemd_boot_stage_duration_seconds gauge
+node_systemd_boot_stage_duration_seconds{stage="kernel"} 1.25
+`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			reg.MustRegister(testSystemdBootCollector{c: c.(*systemdCollector), timestamps: tc.timestamps})
+			if err := testutil.GatherAndCompare(reg, strings.NewReader(tc.expected)); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
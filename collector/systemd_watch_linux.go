@@ -0,0 +1,335 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nosystemd
+// +build !nosystemd
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	godbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	systemdBusName         = "org.freedesktop.systemd1"
+	systemdManagerPath     = "/org/freedesktop/systemd1"
+	systemdManagerIface    = "org.freedesktop.systemd1.Manager"
+	systemdUnitIface       = "org.freedesktop.systemd1.Unit"
+	systemdPrivateSocket   = "unix:path=/run/systemd/private"
+	systemdWatchRetryDelay = 5 * time.Second
+)
+
+// watchedUnit is the cached state of a unit.
+type watchedUnit struct {
+	status       dbus.UnitStatus
+	stateChanges uint64
+	// Type property of service and mount units, fetched on first use.
+	unitType      string
+	unitTypeKnown bool
+}
+
+// systemdUnitWatcher keeps the state of all systemd units in memory, updated
+// from the UnitNew, UnitRemoved and PropertiesChanged signals of systemd, so
+// scrapes don't have to list the units and short lived state changes between
+// scrapes are counted.
+type systemdUnitWatcher struct {
+	logger log.Logger
+
+	mtx    sync.Mutex
+	synced bool
+	units  map[string]*watchedUnit
+}
+
+func newSystemdUnitWatcher(logger log.Logger) *systemdUnitWatcher {
+	return &systemdUnitWatcher{
+		logger: logger,
+		units:  map[string]*watchedUnit{},
+	}
+}
+
+// run watches systemd until the process exits, reconnecting after errors.
+func (w *systemdUnitWatcher) run() {
+	for {
+		err := w.watch()
+		w.mtx.Lock()
+		w.synced = false
+		w.mtx.Unlock()
+		level.Error(w.logger).Log("msg", "Watching systemd units failed, retrying", "err", err)
+		time.Sleep(systemdWatchRetryDelay)
+	}
+}
+
+func (w *systemdUnitWatcher) watch() error {
+	conn, err := newSystemdSignalConn()
+	if err != nil {
+		return fmt.Errorf("couldn't get dbus connection: %w", err)
+	}
+	defer conn.Close()
+
+	signals := make(chan *godbus.Signal, 1024)
+	conn.Signal(signals)
+	if !*systemdPrivate {
+		// The private socket is a direct connection to systemd, which sends
+		// all signals to subscribed clients without match rules.
+		for _, opts := range [][]godbus.MatchOption{
+			{godbus.WithMatchInterface(systemdManagerIface), godbus.WithMatchMember("UnitNew")},
+			{godbus.WithMatchInterface(systemdManagerIface), godbus.WithMatchMember("UnitRemoved")},
+			{godbus.WithMatchInterface(systemdManagerIface), godbus.WithMatchMember("Reloading")},
+			{godbus.WithMatchInterface("org.freedesktop.DBus.Properties"), godbus.WithMatchMember("PropertiesChanged"), godbus.WithMatchArg(0, systemdUnitIface)},
+		} {
+			if err := conn.AddMatchSignal(append(opts, godbus.WithMatchSender(systemdBusName))...); err != nil {
+				return fmt.Errorf("couldn't add signal match: %w", err)
+			}
+		}
+	}
+	if err := conn.Object(systemdBusName, systemdManagerPath).Call(systemdManagerIface+".Subscribe", 0).Err; err != nil {
+		return fmt.Errorf("couldn't subscribe to systemd signals: %w", err)
+	}
+
+	// List the units only once subscribed, so that no change is missed.
+	// Signals queued in the meantime are applied on top of the listing.
+	units, err := listSystemdUnits()
+	if err != nil {
+		return fmt.Errorf("couldn't get units: %w", err)
+	}
+	w.reset(units)
+	level.Debug(w.logger).Log("msg", "Watching systemd units", "units", len(units))
+
+	for signal := range signals {
+		w.handleSignal(signal)
+	}
+	return errors.New("dbus connection closed")
+}
+
+// newSystemdSignalConn opens a connection to systemd that signals can be
+// received on, which the connections of go-systemd don't expose.
+func newSystemdSignalConn() (*godbus.Conn, error) {
+	var (
+		conn *godbus.Conn
+		err  error
+	)
+	if *systemdPrivate {
+		conn, err = godbus.Dial(systemdPrivateSocket)
+	} else {
+		conn, err = godbus.SystemBusPrivate()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Auth([]godbus.Auth{godbus.AuthExternal(strconv.Itoa(os.Getuid()))}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !*systemdPrivate {
+		if err := conn.Hello(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func listSystemdUnits() ([]dbus.UnitStatus, error) {
+	conn, err := newSystemdDbusConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.ListUnitsContext(context.TODO())
+}
+
+func (w *systemdUnitWatcher) handleSignal(signal *godbus.Signal) {
+	var err error
+	switch signal.Name {
+	case systemdManagerIface + ".UnitNew":
+		var name string
+		var unitPath godbus.ObjectPath
+		if err = godbus.Store(signal.Body, &name, &unitPath); err == nil {
+			w.unitNew(name, unitPath)
+		}
+	case systemdManagerIface + ".UnitRemoved":
+		var name string
+		var unitPath godbus.ObjectPath
+		if err = godbus.Store(signal.Body, &name, &unitPath); err == nil {
+			w.unitRemoved(name)
+		}
+	case systemdManagerIface + ".Reloading":
+		var active bool
+		if err = godbus.Store(signal.Body, &active); err == nil && !active {
+			w.reloaded()
+		}
+	case "org.freedesktop.DBus.Properties.PropertiesChanged":
+		var (
+			iface       string
+			changed     map[string]godbus.Variant
+			invalidated []string
+		)
+		if err = godbus.Store(signal.Body, &iface, &changed, &invalidated); err == nil && iface == systemdUnitIface {
+			w.propertiesChanged(signal.Path, changed)
+		}
+	}
+	if err != nil {
+		level.Debug(w.logger).Log("msg", "Invalid systemd signal", "signal", signal.Name, "err", err)
+	}
+}
+
+// reset replaces the cached units with a full listing, counting units whose
+// state changed while no signals were received as having changed once.
+func (w *systemdUnitWatcher) reset(statuses []dbus.UnitStatus) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	units := make(map[string]*watchedUnit, len(statuses))
+	for _, status := range statuses {
+		u := &watchedUnit{status: status}
+		if old, ok := w.units[status.Name]; ok {
+			u.stateChanges = old.stateChanges
+			if old.status.ActiveState != status.ActiveState {
+				u.stateChanges++
+			}
+		}
+		units[status.Name] = u
+	}
+	w.units = units
+	w.synced = true
+}
+
+func (w *systemdUnitWatcher) unitNew(name string, path godbus.ObjectPath) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if _, ok := w.units[name]; !ok {
+		w.units[name] = &watchedUnit{status: dbus.UnitStatus{Name: name, Path: path}}
+	}
+}
+
+func (w *systemdUnitWatcher) unitRemoved(name string) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	delete(w.units, name)
+}
+
+// reloaded forgets the unit types after a daemon-reload, which may have
+// changed them.
+func (w *systemdUnitWatcher) reloaded() {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	for _, u := range w.units {
+		u.unitTypeKnown = false
+	}
+}
+
+func (w *systemdUnitWatcher) propertiesChanged(path godbus.ObjectPath, changed map[string]godbus.Variant) {
+	name := unitNameFromPath(path)
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	u, ok := w.units[name]
+	if !ok {
+		u = &watchedUnit{status: dbus.UnitStatus{Name: name, Path: path}}
+		w.units[name] = u
+	}
+	for property, field := range map[string]*string{
+		"Description": &u.status.Description,
+		"LoadState":   &u.status.LoadState,
+		"SubState":    &u.status.SubState,
+	} {
+		if v, ok := changed[property].Value().(string); ok {
+			*field = v
+		}
+	}
+	if state, ok := changed["ActiveState"].Value().(string); ok {
+		if u.status.ActiveState != "" && u.status.ActiveState != state {
+			u.stateChanges++
+		}
+		u.status.ActiveState = state
+	}
+}
+
+// snapshot returns the cached units sorted by name and the number of active
+// state changes of each, or false if the units aren't known yet.
+func (w *systemdUnitWatcher) snapshot() ([]unit, map[string]uint64, bool) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if !w.synced {
+		return nil, nil, false
+	}
+	units := make([]unit, 0, len(w.units))
+	changes := make(map[string]uint64, len(w.units))
+	for name, u := range w.units {
+		// Units only known from UnitNew have not been loaded yet.
+		if u.status.ActiveState == "" {
+			continue
+		}
+		units = append(units, unit{UnitStatus: u.status})
+		changes[name] = u.stateChanges
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].Name < units[j].Name })
+	return units, changes, true
+}
+
+func (w *systemdUnitWatcher) unitType(name string) (string, bool) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if u, ok := w.units[name]; ok && u.unitTypeKnown {
+		return u.unitType, true
+	}
+	return "", false
+}
+
+func (w *systemdUnitWatcher) setUnitType(name, unitType string) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if u, ok := w.units[name]; ok {
+		u.unitType = unitType
+		u.unitTypeKnown = true
+	}
+}
+
+// unitNameFromPath returns the name of the unit with the given object path,
+// undoing the escaping of systemd, which encodes each byte that isn't
+// alphanumeric as _ followed by two hex digits.
+func unitNameFromPath(p godbus.ObjectPath) string {
+	escaped := path.Base(string(p))
+	name := make([]byte, 0, len(escaped))
+	for i := 0; i < len(escaped); i++ {
+		if escaped[i] == '_' && i+2 < len(escaped) {
+			if b, err := strconv.ParseUint(escaped[i+1:i+3], 16, 8); err == nil {
+				name = append(name, byte(b))
+				i += 2
+				continue
+			}
+		}
+		name = append(name, escaped[i])
+	}
+	return string(name)
+}
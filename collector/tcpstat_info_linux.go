@@ -0,0 +1,274 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !notcpstat
+// +build !notcpstat
+
+package collector
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/josharian/native"
+	"github.com/mdlayher/netlink"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// Offsets of the fields of struct tcp_info in include/uapi/linux/tcp.h.
+	tcpInfoLostOffset         = 32
+	tcpInfoRTTOffset          = 68
+	tcpInfoRTTVarOffset       = 72
+	tcpInfoSndCwndOffset      = 80
+	tcpInfoTotalRetransOffset = 100
+	// delivery_rate was added in Linux 4.9.
+	tcpInfoDeliveryRateOffset = 160
+)
+
+var (
+	tcpstatInfo           = kingpin.Flag("collector.tcpstat.info", "Enables the latency, retransmission, congestion window and delivery rate statistics of established connections.").Bool()
+	tcpstatInfoLocalPorts = kingpin.Flag("collector.tcpstat.info.local-port", "Local port to group the connection statistics by. Can be repeated.").Uint16List()
+	tcpstatInfoRemoteNets = kingpin.Flag("collector.tcpstat.info.remote-cidr", "Remote network, in CIDR notation, to group the connection statistics by. Can be repeated.").Strings()
+
+	tcpInfoRTTBuckets          = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+	tcpInfoCwndBuckets         = prometheus.ExponentialBuckets(1, 2, 11)
+	tcpInfoDeliveryRateBuckets = prometheus.ExponentialBuckets(1e3, 10, 8)
+)
+
+// tcpInfo holds the fields of struct tcp_info that are exposed.
+type tcpInfo struct {
+	lost         uint32
+	rtt          uint32 // microseconds
+	rttVar       uint32 // microseconds
+	sndCwnd      uint32 // segments
+	totalRetrans uint32
+	deliveryRate uint64 // bytes per second
+	// Whether the kernel reports the delivery rate.
+	hasDeliveryRate bool
+}
+
+// tcpInfoHistogram counts observations into fixed buckets.
+type tcpInfoHistogram struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newTCPInfoHistogram(bounds []float64) *tcpInfoHistogram {
+	return &tcpInfoHistogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *tcpInfoHistogram) observe(v float64) {
+	if i := sort.SearchFloat64s(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// buckets returns the cumulative bucket counts.
+func (h *tcpInfoHistogram) buckets() map[float64]uint64 {
+	buckets := make(map[float64]uint64, len(h.bounds))
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		buckets[bound] = cumulative
+	}
+	return buckets
+}
+
+// tcpInfoStats aggregates the tcp_info of a group of connections.
+type tcpInfoStats struct {
+	rtt          *tcpInfoHistogram
+	rttVar       *tcpInfoHistogram
+	sndCwnd      *tcpInfoHistogram
+	deliveryRate *tcpInfoHistogram
+	retransmits  float64
+	lost         float64
+}
+
+func newTCPInfoStats() *tcpInfoStats {
+	return &tcpInfoStats{
+		rtt:          newTCPInfoHistogram(tcpInfoRTTBuckets),
+		rttVar:       newTCPInfoHistogram(tcpInfoRTTBuckets),
+		sndCwnd:      newTCPInfoHistogram(tcpInfoCwndBuckets),
+		deliveryRate: newTCPInfoHistogram(tcpInfoDeliveryRateBuckets),
+	}
+}
+
+func (s *tcpInfoStats) add(info tcpInfo) {
+	s.rtt.observe(float64(info.rtt) / 1e6)
+	s.rttVar.observe(float64(info.rttVar) / 1e6)
+	s.sndCwnd.observe(float64(info.sndCwnd))
+	if info.hasDeliveryRate {
+		s.deliveryRate.observe(float64(info.deliveryRate))
+	}
+	s.retransmits += float64(info.totalRetrans)
+	s.lost += float64(info.lost)
+}
+
+// tcpInfoGrouper assigns connections to the groups configured by the user.
+type tcpInfoGrouper struct {
+	localPorts map[uint16]bool
+	remoteNets []*net.IPNet
+}
+
+func newTCPInfoGrouper(localPorts []uint16, remoteNets []string) (*tcpInfoGrouper, error) {
+	g := &tcpInfoGrouper{localPorts: map[uint16]bool{}}
+	for _, port := range localPorts {
+		g.localPorts[port] = true
+	}
+	for _, cidr := range remoteNets {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid remote network %q: %w", cidr, err)
+		}
+		g.remoteNets = append(g.remoteNets, ipNet)
+	}
+	return g, nil
+}
+
+// enabled reports whether connections are grouped at all.
+func (g *tcpInfoGrouper) enabled() bool {
+	return len(g.localPorts) > 0 || len(g.remoteNets) > 0
+}
+
+// group returns the local port or remote network of the first matching
+// group, or "other".
+func (g *tcpInfoGrouper) group(msg *InetDiagMsg) string {
+	if port := msg.ID.sourcePort(); g.localPorts[port] {
+		return strconv.Itoa(int(port))
+	}
+	if len(g.remoteNets) > 0 {
+		ip := msg.ID.destIP(msg.Family)
+		for _, ipNet := range g.remoteNets {
+			if ipNet.Contains(ip) {
+				return ipNet.String()
+			}
+		}
+	}
+	return "other"
+}
+
+// parseTCPInfoStats aggregates the tcp_info of the established connections
+// by group.
+func parseTCPInfoStats(msgs []netlink.Message, grouper *tcpInfoGrouper) (map[string]*tcpInfoStats, error) {
+	stats := map[string]*tcpInfoStats{}
+
+	for _, m := range msgs {
+		msg := parseInetDiagMsg(m.Data)
+		if tcpConnectionState(msg.State) != tcpEstablished {
+			continue
+		}
+		info, ok, err := parseInetDiagTCPInfo(m.Data)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		group := ""
+		if grouper.enabled() {
+			group = grouper.group(msg)
+		}
+		if stats[group] == nil {
+			stats[group] = newTCPInfoStats()
+		}
+		stats[group].add(info)
+	}
+
+	return stats, nil
+}
+
+// parseInetDiagTCPInfo returns the tcp_info in the attributes of an
+// inet_diag message, if any.
+func parseInetDiagTCPInfo(data []byte) (tcpInfo, bool, error) {
+	b, err := inetDiagAttribute(data, inetDiagInfo)
+	if err != nil || b == nil {
+		return tcpInfo{}, false, err
+	}
+	info, ok := parseTCPInfo(b)
+	return info, ok, nil
+}
+
+// parseTCPInfo parses struct tcp_info, whose size depends on the kernel.
+func parseTCPInfo(b []byte) (tcpInfo, bool) {
+	if len(b) < tcpInfoTotalRetransOffset+4 {
+		return tcpInfo{}, false
+	}
+	u32 := func(offset int) uint32 { return native.Endian.Uint32(b[offset:]) }
+	info := tcpInfo{
+		lost:         u32(tcpInfoLostOffset),
+		rtt:          u32(tcpInfoRTTOffset),
+		rttVar:       u32(tcpInfoRTTVarOffset),
+		sndCwnd:      u32(tcpInfoSndCwndOffset),
+		totalRetrans: u32(tcpInfoTotalRetransOffset),
+	}
+	if len(b) >= tcpInfoDeliveryRateOffset+8 {
+		info.deliveryRate = native.Endian.Uint64(b[tcpInfoDeliveryRateOffset:])
+		info.hasDeliveryRate = true
+	}
+	return info, true
+}
+
+// tcpInfoDescs are the descriptors of the tcp_info statistics.
+type tcpInfoDescs struct {
+	rtt          *prometheus.Desc
+	rttVar       *prometheus.Desc
+	sndCwnd      *prometheus.Desc
+	deliveryRate *prometheus.Desc
+	retransmits  typedDesc
+	lost         typedDesc
+}
+
+func newTCPInfoDescs(grouped bool) tcpInfoDescs {
+	var labels []string
+	if grouped {
+		labels = []string{"group"}
+	}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "tcp", name), help, labels, nil)
+	}
+	return tcpInfoDescs{
+		rtt:          desc("connection_rtt_seconds", "Smoothed round trip time of the established connections."),
+		rttVar:       desc("connection_rtt_variance_seconds", "Round trip time variance of the established connections."),
+		sndCwnd:      desc("connection_congestion_window_segments", "Congestion window of the established connections."),
+		deliveryRate: desc("connection_delivery_rate_bytes_per_second", "Most recent delivery rate of the established connections."),
+		retransmits:  typedDesc{desc("connection_retransmitted_segments", "Segments retransmitted over the lifetime of the established connections."), prometheus.GaugeValue},
+		lost:         typedDesc{desc("connection_lost_segments", "Segments of the established connections currently presumed lost."), prometheus.GaugeValue},
+	}
+}
+
+func (d tcpInfoDescs) export(ch chan<- prometheus.Metric, stats map[string]*tcpInfoStats) {
+	for group, s := range stats {
+		var labels []string
+		if group != "" {
+			labels = []string{group}
+		}
+		for desc, h := range map[*prometheus.Desc]*tcpInfoHistogram{
+			d.rtt:          s.rtt,
+			d.rttVar:       s.rttVar,
+			d.sndCwnd:      s.sndCwnd,
+			d.deliveryRate: s.deliveryRate,
+		} {
+			ch <- prometheus.MustNewConstHistogram(desc, h.count, h.sum, h.buckets(), labels...)
+		}
+		ch <- d.retransmits.mustNewConstMetric(s.retransmits, labels...)
+		ch <- d.lost.mustNewConstMetric(s.lost, labels...)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !notcpstat
+// +build !notcpstat
+
+package collector
+
+import (
+	"math"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/josharian/native"
+	"github.com/mdlayher/netlink"
+)
+
+// encodeTCPInfoMsg returns an inet_diag message of an established connection
+// with a tcp_info attribute of the given size.
+func encodeTCPInfoMsg(t *testing.T, family uint8, id InetDiagSockID, size int, info tcpInfo) netlink.Message {
+	b := make([]byte, size)
+	native.Endian.PutUint32(b[tcpInfoLostOffset:], info.lost)
+	native.Endian.PutUint32(b[tcpInfoRTTOffset:], info.rtt)
+	native.Endian.PutUint32(b[tcpInfoRTTVarOffset:], info.rttVar)
+	native.Endian.PutUint32(b[tcpInfoSndCwndOffset:], info.sndCwnd)
+	native.Endian.PutUint32(b[tcpInfoTotalRetransOffset:], info.totalRetrans)
+	if size >= tcpInfoDeliveryRateOffset+8 {
+		native.Endian.PutUint64(b[tcpInfoDeliveryRateOffset:], info.deliveryRate)
+	}
+	ae := netlink.NewAttributeEncoder()
+	ae.Bytes(inetDiagInfo, b)
+	attrs, err := ae.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := encodeInetDiagMsg(t, InetDiagMsg{Family: family, State: uint8(tcpEstablished), ID: id})
+	m.Data = append(m.Data, attrs...)
+	return m
+}
+
+func inetDiagSockIDTo(family uint8, srcPort uint16, dstIP net.IP) InetDiagSockID {
+	id := inetDiagSockID(net.IPv4zero, srcPort, 0)
+	if family == syscall.AF_INET {
+		copy(id.DestIP[0][:], dstIP.To4())
+		return id
+	}
+	for i := range id.DestIP {
+		copy(id.DestIP[i][:], dstIP.To16()[i*4:])
+	}
+	return id
+}
+
+func Test_parseTCPInfoStats(t *testing.T) {
+	msgs := []netlink.Message{
+		encodeTCPInfoMsg(t, syscall.AF_INET, inetDiagSockIDTo(syscall.AF_INET, 443, net.ParseIP("192.0.2.10")), 232,
+			tcpInfo{rtt: 800, rttVar: 200, sndCwnd: 10, totalRetrans: 2, deliveryRate: 125000}),
+		encodeTCPInfoMsg(t, syscall.AF_INET, inetDiagSockIDTo(syscall.AF_INET, 443, net.ParseIP("192.0.2.11")), 232,
+			tcpInfo{rtt: 30000, rttVar: 5000, sndCwnd: 40, lost: 1, deliveryRate: 2500000}),
+		// An IPv4 connection of an IPv6 socket, on a kernel older than 4.9
+		// without delivery rate.
+		encodeTCPInfoMsg(t, syscall.AF_INET6, inetDiagSockIDTo(syscall.AF_INET6, 51000, net.ParseIP("10.1.2.3")), 104,
+			tcpInfo{rtt: 120000, rttVar: 1000, sndCwnd: 3, totalRetrans: 7}),
+		encodeTCPInfoMsg(t, syscall.AF_INET, inetDiagSockIDTo(syscall.AF_INET, 51001, net.ParseIP("198.51.100.1")), 232,
+			tcpInfo{rtt: 2000, sndCwnd: 10}),
+		// Listening sockets are ignored.
+		encodeInetDiagMsg(t, InetDiagMsg{Family: syscall.AF_INET, State: uint8(tcpListen), ID: inetDiagSockID(net.IPv4zero, 443, 0)}),
+	}
+
+	grouper, err := newTCPInfoGrouper([]uint16{443}, []string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := parseTCPInfoStats(msgs, grouper)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 3, len(stats); want != got {
+		t.Fatalf("want %d groups, got %d", want, got)
+	}
+	https := stats["443"]
+	if https == nil {
+		t.Fatal("no statistics of local port 443")
+	}
+	if want, got := uint64(2), https.rtt.count; want != got {
+		t.Errorf("want %d connections on port 443, got %d", want, got)
+	}
+	if want, got := 0.0308, https.rtt.sum; math.Abs(want-got) > 1e-9 {
+		t.Errorf("want rtt sum %v on port 443, got %v", want, got)
+	}
+	if want, got := uint64(1), https.rtt.buckets()[.001]; want != got {
+		t.Errorf("want %d connections with rtt below 1ms, got %d", want, got)
+	}
+	if want, got := uint64(2), https.rtt.buckets()[.05]; want != got {
+		t.Errorf("want %d connections with rtt below 50ms, got %d", want, got)
+	}
+	if want, got := uint64(1), https.sndCwnd.buckets()[16]; want != got {
+		t.Errorf("want %d connections with a congestion window up to 16 segments, got %d", want, got)
+	}
+	if want, got := 2.0, https.retransmits; want != got {
+		t.Errorf("want %v retransmits on port 443, got %v", want, got)
+	}
+	if want, got := 1.0, https.lost; want != got {
+		t.Errorf("want %v lost segments on port 443, got %v", want, got)
+	}
+
+	private := stats["10.0.0.0/8"]
+	if private == nil {
+		t.Fatal("no statistics of remote network 10.0.0.0/8")
+	}
+	if want, got := uint64(0), private.deliveryRate.count; want != got {
+		t.Errorf("want no delivery rate without kernel support, got %d", got)
+	}
+	if want, got := 7.0, private.retransmits; want != got {
+		t.Errorf("want %v retransmits to 10.0.0.0/8, got %v", want, got)
+	}
+	if want, got := uint64(1), stats["other"].rtt.count; want != got {
+		t.Errorf("want %d other connections, got %d", want, got)
+	}
+}
+
+func Test_parseTCPInfoShort(t *testing.T) {
+	if _, ok := parseTCPInfo(make([]byte, 64)); ok {
+		t.Error("parsed truncated tcp_info")
+	}
+	b := make([]byte, tcpInfoDeliveryRateOffset+8)
+	if info, ok := parseTCPInfo(b); !ok || !info.hasDeliveryRate {
+		t.Errorf("want delivery rate in %d bytes of tcp_info, got %+v", len(b), info)
+	}
+}
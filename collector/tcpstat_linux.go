@@ -18,10 +18,12 @@ package collector
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"strconv"
 	"syscall"
-	"unsafe"
 
+	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
 	"github.com/mdlayher/netlink"
 	"github.com/prometheus/client_golang/prometheus"
@@ -58,9 +60,26 @@ const (
 	tcpTxQueuedBytes
 )
 
+var (
+	tcpstatLocalPorts  = kingpin.Flag("collector.tcpstat.local-port", "Local port to break down connection states by. Can be repeated.").Uint16List()
+	tcpstatRemotePorts = kingpin.Flag("collector.tcpstat.remote-port", "Remote port to break down connection states by. Can be repeated.").Uint16List()
+	tcpstatListeners   = kingpin.Flag("collector.tcpstat.listeners", "Enables the accept queue metrics of each listening socket.").Bool()
+)
+
 type tcpStatCollector struct {
-	desc   typedDesc
-	logger log.Logger
+	desc              typedDesc
+	localPortDesc     typedDesc
+	remotePortDesc    typedDesc
+	acceptQueueDesc   typedDesc
+	acceptBacklogDesc typedDesc
+	localPorts        map[uint16]bool
+	remotePorts       map[uint16]bool
+	listeners         bool
+	// tcp_info statistics, grouped by infoGrouper, if enabled.
+	info        bool
+	infoGrouper *tcpInfoGrouper
+	infoDescs   tcpInfoDescs
+	logger      log.Logger
 }
 
 func init() {
@@ -69,120 +88,119 @@ func init() {
 
 // NewTCPStatCollector returns a new Collector exposing network stats.
 func NewTCPStatCollector(logger log.Logger) (Collector, error) {
+	ports := func(list []uint16) map[uint16]bool {
+		m := make(map[uint16]bool, len(list))
+		for _, port := range list {
+			m[port] = true
+		}
+		return m
+	}
+	infoGrouper, err := newTCPInfoGrouper(*tcpstatInfoLocalPorts, *tcpstatInfoRemoteNets)
+	if err != nil {
+		return nil, err
+	}
 	return &tcpStatCollector{
 		desc: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "tcp", "connection_states"),
 			"Number of connection states.",
 			[]string{"state"}, nil,
 		), prometheus.GaugeValue},
-		logger: logger,
+		localPortDesc: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tcp", "local_port_connection_states"),
+			"Number of connection states by local port.",
+			[]string{"port", "state"}, nil,
+		), prometheus.GaugeValue},
+		remotePortDesc: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tcp", "remote_port_connection_states"),
+			"Number of connection states by remote port.",
+			[]string{"port", "state"}, nil,
+		), prometheus.GaugeValue},
+		acceptQueueDesc: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tcp", "listen_accept_queue"),
+			"Number of established connections waiting to be accepted by the listening socket.",
+			[]string{"address", "port"}, nil,
+		), prometheus.GaugeValue},
+		acceptBacklogDesc: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tcp", "listen_accept_queue_limit"),
+			"Maximum number of connections waiting to be accepted by the listening socket, its backlog.",
+			[]string{"address", "port"}, nil,
+		), prometheus.GaugeValue},
+		localPorts:  ports(*tcpstatLocalPorts),
+		remotePorts: ports(*tcpstatRemotePorts),
+		listeners:   *tcpstatListeners,
+		info:        *tcpstatInfo,
+		infoGrouper: infoGrouper,
+		infoDescs:   newTCPInfoDescs(infoGrouper.enabled()),
+		logger:      logger,
 	}, nil
 }
 
-// InetDiagSockID (inet_diag_sockid) contains the socket identity.
-// https://github.com/torvalds/linux/blob/v4.0/include/uapi/linux/inet_diag.h#L13
-type InetDiagSockID struct {
-	SourcePort [2]byte
-	DestPort   [2]byte
-	SourceIP   [4][4]byte
-	DestIP     [4][4]byte
-	Interface  uint32
-	Cookie     [2]uint32
-}
-
-// InetDiagReqV2 (inet_diag_req_v2) is used to request diagnostic data.
-// https://github.com/torvalds/linux/blob/v4.0/include/uapi/linux/inet_diag.h#L37
-type InetDiagReqV2 struct {
-	Family   uint8
-	Protocol uint8
-	Ext      uint8
-	Pad      uint8
-	States   uint32
-	ID       InetDiagSockID
-}
-
-const sizeOfDiagRequest = 0x38
-
-func (req *InetDiagReqV2) Serialize() []byte {
-	return (*(*[sizeOfDiagRequest]byte)(unsafe.Pointer(req)))[:]
-}
-
-func (req *InetDiagReqV2) Len() int {
-	return sizeOfDiagRequest
-}
-
-type InetDiagMsg struct {
-	Family  uint8
-	State   uint8
-	Timer   uint8
-	Retrans uint8
-	ID      InetDiagSockID
-	Expires uint32
-	RQueue  uint32
-	WQueue  uint32
-	UID     uint32
-	Inode   uint32
-}
-
-func parseInetDiagMsg(b []byte) *InetDiagMsg {
-	return (*InetDiagMsg)(unsafe.Pointer(&b[0]))
+func (c *tcpStatCollector) Update(ch chan<- prometheus.Metric) error {
+	return forEachNetNamespace(ch, c.logger, c.update)
 }
 
-func (c *tcpStatCollector) Update(ch chan<- prometheus.Metric) error {
-	tcpStats, err := getTCPStats(syscall.AF_INET)
+func (c *tcpStatCollector) update(ch chan<- prometheus.Metric, ns netNamespace) error {
+	// The netlink socket is created in the namespace of the calling thread.
+	messages, err := getTCPDiagMessages(syscall.AF_INET)
 	if err != nil {
 		return fmt.Errorf("couldn't get tcpstats: %w", err)
 	}
 
 	// if enabled ipv6 system
-	if _, hasIPv6 := os.Stat(procFilePath("net/tcp6")); hasIPv6 == nil {
-		tcp6Stats, err := getTCPStats(syscall.AF_INET6)
+	if _, hasIPv6 := os.Stat(ns.procFilePath("net/tcp6")); hasIPv6 == nil {
+		messages6, err := getTCPDiagMessages(syscall.AF_INET6)
 		if err != nil {
 			return fmt.Errorf("couldn't get tcp6stats: %w", err)
 		}
-
-		for st, value := range tcp6Stats {
-			tcpStats[st] += value
-		}
+		messages = append(messages, messages6...)
 	}
 
+	tcpStats, err := parseTCPStats(messages)
+	if err != nil {
+		return fmt.Errorf("couldn't parse tcpstats: %w", err)
+	}
 	for st, value := range tcpStats {
 		ch <- c.desc.mustNewConstMetric(value, st.String())
 	}
 
-	return nil
-}
-
-func getTCPStats(family uint8) (map[tcpConnectionState]float64, error) {
-	const TCPFAll = 0xFFF
-	const InetDiagInfo = 2
-	const SockDiagByFamily = 20
-
-	conn, err := netlink.Dial(syscall.NETLINK_INET_DIAG, nil)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't connect netlink: %w", err)
+	if len(c.localPorts) > 0 || len(c.remotePorts) > 0 {
+		local, remote := parseTCPPortStats(messages, c.localPorts, c.remotePorts)
+		c.exportPortStats(ch, c.localPortDesc, local)
+		c.exportPortStats(ch, c.remotePortDesc, remote)
 	}
-	defer conn.Close()
-
-	msg := netlink.Message{
-		Header: netlink.Header{
-			Type:  SockDiagByFamily,
-			Flags: syscall.NLM_F_REQUEST | syscall.NLM_F_DUMP,
-		},
-		Data: (&InetDiagReqV2{
-			Family:   family,
-			Protocol: syscall.IPPROTO_TCP,
-			States:   TCPFAll,
-			Ext:      0 | 1<<(InetDiagInfo-1),
-		}).Serialize(),
+	if c.listeners {
+		for _, l := range parseTCPListeners(messages) {
+			address, port := l.address.String(), strconv.Itoa(int(l.port))
+			ch <- c.acceptQueueDesc.mustNewConstMetric(float64(l.queue), address, port)
+			ch <- c.acceptBacklogDesc.mustNewConstMetric(float64(l.backlog), address, port)
+		}
+	}
+	if c.info {
+		infoStats, err := parseTCPInfoStats(messages, c.infoGrouper)
+		if err != nil {
+			return fmt.Errorf("couldn't parse tcp_info: %w", err)
+		}
+		c.infoDescs.export(ch, infoStats)
 	}
 
-	messages, err := conn.Execute(msg)
-	if err != nil {
-		return nil, err
+	return nil
+}
+
+func (c *tcpStatCollector) exportPortStats(ch chan<- prometheus.Metric, desc typedDesc, stats map[uint16]map[tcpConnectionState]float64) {
+	for port, states := range stats {
+		for st, value := range states {
+			ch <- desc.mustNewConstMetric(value, strconv.Itoa(int(port)), st.String())
+		}
 	}
+}
 
-	return parseTCPStats(messages)
+func getTCPDiagMessages(family uint8) ([]netlink.Message, error) {
+	return sockDiagDump(&InetDiagReqV2{
+		Family:   family,
+		Protocol: syscall.IPPROTO_TCP,
+		States:   tcpfAll,
+		Ext:      1 << (inetDiagInfo - 1),
+	})
 }
 
 func parseTCPStats(msgs []netlink.Message) (map[tcpConnectionState]float64, error) {
@@ -231,3 +249,70 @@ func (st tcpConnectionState) String() string {
 		return "unknown"
 	}
 }
+
+// parseTCPPortStats counts the connection states of the sockets with one of
+// the given local or remote ports, by port.
+func parseTCPPortStats(msgs []netlink.Message, localPorts, remotePorts map[uint16]bool) (local, remote map[uint16]map[tcpConnectionState]float64) {
+	local = map[uint16]map[tcpConnectionState]float64{}
+	remote = map[uint16]map[tcpConnectionState]float64{}
+	count := func(stats map[uint16]map[tcpConnectionState]float64, port uint16, state tcpConnectionState) {
+		if stats[port] == nil {
+			stats[port] = map[tcpConnectionState]float64{}
+		}
+		stats[port][state]++
+	}
+
+	for _, m := range msgs {
+		msg := parseInetDiagMsg(m.Data)
+		state := tcpConnectionState(msg.State)
+		if port := msg.ID.sourcePort(); localPorts[port] {
+			count(local, port, state)
+		}
+		// Listening sockets have no remote end.
+		if port := msg.ID.destPort(); remotePorts[port] && state != tcpListen {
+			count(remote, port, state)
+		}
+	}
+
+	return local, remote
+}
+
+// tcpListener is the accept queue of a listening socket.
+type tcpListener struct {
+	address net.IP
+	port    uint16
+	// Number of connections waiting to be accepted, and the maximum.
+	queue   uint32
+	backlog uint32
+}
+
+// parseTCPListeners returns the accept queues of the listening sockets, which
+// inet_diag reports in place of the receive and send queues. The queues of
+// sockets sharing an address with SO_REUSEPORT are added up.
+func parseTCPListeners(msgs []netlink.Message) []tcpListener {
+	var listeners []tcpListener
+	index := map[string]int{}
+
+	for _, m := range msgs {
+		msg := parseInetDiagMsg(m.Data)
+		if tcpConnectionState(msg.State) != tcpListen {
+			continue
+		}
+		address, port := msg.ID.sourceIP(msg.Family), msg.ID.sourcePort()
+		key := net.JoinHostPort(address.String(), strconv.Itoa(int(port)))
+		if i, ok := index[key]; ok {
+			listeners[i].queue += msg.RQueue
+			listeners[i].backlog += msg.WQueue
+			continue
+		}
+		index[key] = len(listeners)
+		listeners = append(listeners, tcpListener{
+			address: address,
+			port:    port,
+			queue:   msg.RQueue,
+			backlog: msg.WQueue,
+		})
+	}
+
+	return listeners
+}
@@ -19,6 +19,7 @@ package collector
 import (
 	"bytes"
 	"encoding/binary"
+	"net"
 	"syscall"
 	"testing"
 
@@ -88,3 +89,82 @@ func Test_parseTCPStats(t *testing.T) {
 	}
 
 }
+
+func encodeInetDiagMsg(t *testing.T, m InetDiagMsg) netlink.Message {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, native.Endian, m); err != nil {
+		t.Fatal(err)
+	}
+	return netlink.Message{Data: buf.Bytes()}
+}
+
+func inetDiagSockID(srcIP net.IP, srcPort uint16, dstPort uint16) InetDiagSockID {
+	var id InetDiagSockID
+	binary.BigEndian.PutUint16(id.SourcePort[:], srcPort)
+	binary.BigEndian.PutUint16(id.DestPort[:], dstPort)
+	if ip4 := srcIP.To4(); ip4 != nil {
+		copy(id.SourceIP[0][:], ip4)
+	} else {
+		for i := range id.SourceIP {
+			copy(id.SourceIP[i][:], srcIP[i*4:])
+		}
+	}
+	return id
+}
+
+func Test_parseTCPPortStats(t *testing.T) {
+	msgs := []netlink.Message{
+		encodeInetDiagMsg(t, InetDiagMsg{Family: syscall.AF_INET, State: uint8(tcpListen), ID: inetDiagSockID(net.IPv4zero, 443, 0)}),
+		encodeInetDiagMsg(t, InetDiagMsg{Family: syscall.AF_INET, State: uint8(tcpEstablished), ID: inetDiagSockID(net.ParseIP("10.0.0.1"), 443, 51234)}),
+		encodeInetDiagMsg(t, InetDiagMsg{Family: syscall.AF_INET, State: uint8(tcpEstablished), ID: inetDiagSockID(net.ParseIP("10.0.0.1"), 443, 51235)}),
+		encodeInetDiagMsg(t, InetDiagMsg{Family: syscall.AF_INET6, State: uint8(tcpTimeWait), ID: inetDiagSockID(net.ParseIP("2001:db8::1"), 443, 40000)}),
+		encodeInetDiagMsg(t, InetDiagMsg{Family: syscall.AF_INET, State: uint8(tcpEstablished), ID: inetDiagSockID(net.ParseIP("10.0.0.1"), 40001, 5432)}),
+		encodeInetDiagMsg(t, InetDiagMsg{Family: syscall.AF_INET, State: uint8(tcpListen), ID: inetDiagSockID(net.IPv4zero, 5432, 0)}),
+	}
+
+	local, remote := parseTCPPortStats(msgs, map[uint16]bool{443: true}, map[uint16]bool{5432: true, 0: true})
+	if want, got := 1.0, local[443][tcpListen]; want != got {
+		t.Errorf("want %v listening sockets on local port 443, got %v", want, got)
+	}
+	if want, got := 2.0, local[443][tcpEstablished]; want != got {
+		t.Errorf("want %v established connections on local port 443, got %v", want, got)
+	}
+	if want, got := 1.0, local[443][tcpTimeWait]; want != got {
+		t.Errorf("want %v time wait connections on local port 443, got %v", want, got)
+	}
+	if want, got := 1, len(remote); want != got {
+		t.Errorf("want %v remote ports, got %v", want, remote)
+	}
+	if want, got := 1.0, remote[5432][tcpEstablished]; want != got {
+		t.Errorf("want %v established connections to remote port 5432, got %v", want, got)
+	}
+}
+
+func Test_parseTCPListeners(t *testing.T) {
+	msgs := []netlink.Message{
+		encodeInetDiagMsg(t, InetDiagMsg{Family: syscall.AF_INET, State: uint8(tcpListen), ID: inetDiagSockID(net.IPv4zero, 80, 0), RQueue: 3, WQueue: 128}),
+		// A second socket on the same address with SO_REUSEPORT.
+		encodeInetDiagMsg(t, InetDiagMsg{Family: syscall.AF_INET, State: uint8(tcpListen), ID: inetDiagSockID(net.IPv4zero, 80, 0), RQueue: 1, WQueue: 128}),
+		encodeInetDiagMsg(t, InetDiagMsg{Family: syscall.AF_INET6, State: uint8(tcpListen), ID: inetDiagSockID(net.IPv6loopback, 8080, 0), RQueue: 0, WQueue: 4096}),
+		encodeInetDiagMsg(t, InetDiagMsg{Family: syscall.AF_INET, State: uint8(tcpEstablished), ID: inetDiagSockID(net.ParseIP("10.0.0.1"), 80, 51234), RQueue: 10, WQueue: 20}),
+	}
+
+	listeners := parseTCPListeners(msgs)
+	want := []struct {
+		address        string
+		port           uint16
+		queue, backlog uint32
+	}{
+		{"0.0.0.0", 80, 4, 256},
+		{"::1", 8080, 0, 4096},
+	}
+	if len(listeners) != len(want) {
+		t.Fatalf("want %d listeners, got %+v", len(want), listeners)
+	}
+	for i, w := range want {
+		l := listeners[i]
+		if l.address.String() != w.address || l.port != w.port || l.queue != w.queue || l.backlog != w.backlog {
+			t.Errorf("want listener %+v, got %+v", w, l)
+		}
+	}
+}
@@ -18,6 +18,7 @@ package collector
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
@@ -30,22 +31,57 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
 )
 
 var (
-	textFileDirectory = kingpin.Flag("collector.textfile.directory", "Directory to read text files with metrics from.").Default("").String()
-	mtimeDesc         = prometheus.NewDesc(
+	textFileDirectory          = kingpin.Flag("collector.textfile.directory", "Directory to read text files with metrics from.").Default("").String()
+	textFileRecursive          = kingpin.Flag("collector.textfile.recursive", "Also read text files from subdirectories of the textfile directory. Symlinked directories are not followed.").Bool()
+	textFilePathLabels         = kingpin.Flag("collector.textfile.path-labels", "Template relative to the textfile directory that maps path components to labels, e.g. '<team>/<job>.prom'.").Default("").String()
+	textFileNamePolicy         = kingpin.Flag("collector.textfile.name-policy", "What to do with metric families that collide with metrics of other collectors or lack the allowed prefix: off, reject or rewrite (prepend the allowed prefix, or textfile_ if none).").Default("off").Enum("off", "reject", "rewrite")
+	textFileAllowedPrefixes    = kingpin.Flag("collector.textfile.allowed-prefix", "Metric name prefix required by the name policy, as [<directory>=]<prefix>. Can be repeated for different directories.").Strings()
+	textFileTimestamps         = kingpin.Flag("collector.textfile.timestamps", "Pass client-side timestamps in text files through to the exposition instead of rejecting the file.").Bool()
+	textFileTimestampMaxAge    = kingpin.Flag("collector.textfile.timestamps.max-age", "Drop timestamped samples older than this. 0 disables the check.").Default("1h").Duration()
+	textFileTimestampMaxFuture = kingpin.Flag("collector.textfile.timestamps.max-future", "Drop timestamped samples further than this in the future. 0 disables the check.").Default("5m").Duration()
+	mtimeDesc                  = prometheus.NewDesc(
 		"node_textfile_mtime_seconds",
 		"Unixtime mtime of textfiles successfully read.",
 		[]string{"file"},
 		nil,
 	)
+	namePolicyViolationsDesc = prometheus.NewDesc(
+		"node_textfile_name_policy_violations",
+		"Number of metric families in a textfile that violated the name policy.",
+		[]string{"file"},
+		nil,
+	)
+	timestampRejectedDesc = prometheus.NewDesc(
+		"node_textfile_timestamp_rejected_samples",
+		"Number of samples dropped from a textfile because their timestamp was outside the accepted window.",
+		[]string{"file"},
+		nil,
+	)
 )
 
 type textFileCollector struct {
-	path string
+	path      string
+	recursive bool
+	// Path components relative to the textfile directory, either a literal
+	// directory or file name, or a "<label>" placeholder.
+	pathLabels []string
+	// Name policy, either empty when disabled, "reject" or "rewrite".
+	namePolicy string
+	// Allowed metric name prefix per directory; the "" key applies to
+	// directories without an entry of their own.
+	allowedPrefixes map[string]string
+	// Pass client-side timestamps through, dropping samples outside of
+	// [now-maxAge, now+maxFuture]. A zero bound disables that side's check.
+	timestamps bool
+	maxAge     time.Duration
+	maxFuture  time.Duration
 	// Only set for testing to get predictable output.
 	mtime  *float64
+	now    func() time.Time
 	logger log.Logger
 }
 
@@ -53,115 +89,81 @@ func init() {
 	registerCollector("textfile", defaultEnabled, NewTextFileCollector)
 }
 
-// NewTextFileCollector returns a new Collector exposing metrics read from files
-// in the given textfile directory.
-func NewTextFileCollector(logger log.Logger) (Collector, error) {
-	c := &textFileCollector{
-		path:   *textFileDirectory,
-		logger: logger,
+// parsePathLabelsTemplate splits a template such as "<team>/<job>.prom" into
+// its path components and validates the label names it contains.
+func parsePathLabelsTemplate(tmpl string) ([]string, error) {
+	if tmpl == "" {
+		return nil, nil
 	}
-	return c, nil
-}
-
-func convertMetricFamily(metricFamily *dto.MetricFamily, ch chan<- prometheus.Metric, logger log.Logger) {
-	var valType prometheus.ValueType
-	var val float64
-
-	allLabelNames := map[string]struct{}{}
-	for _, metric := range metricFamily.Metric {
-		labels := metric.GetLabel()
-		for _, label := range labels {
-			if _, ok := allLabelNames[label.GetName()]; !ok {
-				allLabelNames[label.GetName()] = struct{}{}
-			}
-		}
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(tmpl)), "/")
+	if !strings.HasSuffix(parts[len(parts)-1], ".prom") {
+		return nil, fmt.Errorf("textfile path label template %q must end in .prom", tmpl)
 	}
-
-	for _, metric := range metricFamily.Metric {
-		if metric.TimestampMs != nil {
-			level.Warn(logger).Log("msg", "Ignoring unsupported custom timestamp on textfile collector metric", "metric", metric)
-		}
-
-		labels := metric.GetLabel()
-		var names []string
-		var values []string
-		for _, label := range labels {
-			names = append(names, label.GetName())
-			values = append(values, label.GetValue())
+	seen := map[string]struct{}{}
+	for i, part := range parts {
+		if i == len(parts)-1 {
+			part = strings.TrimSuffix(part, ".prom")
 		}
-
-		for k := range allLabelNames {
-			present := false
-			for _, name := range names {
-				if k == name {
-					present = true
-					break
-				}
-			}
-			if !present {
-				names = append(names, k)
-				values = append(values, "")
+		if !strings.HasPrefix(part, "<") || !strings.HasSuffix(part, ">") {
+			if strings.ContainsAny(part, "<>") {
+				return nil, fmt.Errorf("textfile path label template %q has malformed component %q", tmpl, part)
 			}
+			continue
 		}
+		name := part[1 : len(part)-1]
+		if !model.LabelName(name).IsValid() {
+			return nil, fmt.Errorf("textfile path label template %q has invalid label name %q", tmpl, name)
+		}
+		if _, ok := seen[name]; ok {
+			return nil, fmt.Errorf("textfile path label template %q uses label %q more than once", tmpl, name)
+		}
+		seen[name] = struct{}{}
+	}
+	return parts, nil
+}
 
-		metricType := metricFamily.GetType()
-		switch metricType {
-		case dto.MetricType_COUNTER:
-			valType = prometheus.CounterValue
-			val = metric.Counter.GetValue()
-
-		case dto.MetricType_GAUGE:
-			valType = prometheus.GaugeValue
-			val = metric.Gauge.GetValue()
-
-		case dto.MetricType_UNTYPED:
-			valType = prometheus.UntypedValue
-			val = metric.Untyped.GetValue()
-
-		case dto.MetricType_SUMMARY:
-			quantiles := map[float64]float64{}
-			for _, q := range metric.Summary.Quantile {
-				quantiles[q.GetQuantile()] = q.GetValue()
-			}
-			ch <- prometheus.MustNewConstSummary(
-				prometheus.NewDesc(
-					*metricFamily.Name,
-					metricFamily.GetHelp(),
-					names, nil,
-				),
-				metric.Summary.GetSampleCount(),
-				metric.Summary.GetSampleSum(),
-				quantiles, values...,
-			)
-		case dto.MetricType_HISTOGRAM:
-			buckets := map[float64]uint64{}
-			for _, b := range metric.Histogram.Bucket {
-				buckets[b.GetUpperBound()] = b.GetCumulativeCount()
-			}
-			ch <- prometheus.MustNewConstHistogram(
-				prometheus.NewDesc(
-					*metricFamily.Name,
-					metricFamily.GetHelp(),
-					names, nil,
-				),
-				metric.Histogram.GetSampleCount(),
-				metric.Histogram.GetSampleSum(),
-				buckets, values...,
-			)
-		default:
-			panic("unknown metric type")
+// parseAllowedPrefixes parses [<directory>=]<prefix> flag values.
+func parseAllowedPrefixes(values []string) (map[string]string, error) {
+	prefixes := make(map[string]string, len(values))
+	for _, v := range values {
+		dir, prefix := "", v
+		if i := strings.LastIndex(v, "="); i >= 0 {
+			dir, prefix = filepath.Clean(v[:i]), v[i+1:]
 		}
-		if metricType == dto.MetricType_GAUGE || metricType == dto.MetricType_COUNTER || metricType == dto.MetricType_UNTYPED {
-			ch <- prometheus.MustNewConstMetric(
-				prometheus.NewDesc(
-					*metricFamily.Name,
-					metricFamily.GetHelp(),
-					names, nil,
-				),
-				valType, val, values...,
-			)
+		if !model.IsValidMetricName(model.LabelValue(prefix)) {
+			return nil, fmt.Errorf("invalid textfile metric name prefix %q", v)
 		}
+		prefixes[dir] = prefix
 	}
+	return prefixes, nil
+}
+
+// NewTextFileCollector returns a new Collector exposing metrics read from files
+// in the given textfile directory.
+func NewTextFileCollector(logger log.Logger) (Collector, error) {
+	pathLabels, err := parsePathLabelsTemplate(*textFilePathLabels)
+	if err != nil {
+		return nil, err
+	}
+	allowedPrefixes, err := parseAllowedPrefixes(*textFileAllowedPrefixes)
+	if err != nil {
+		return nil, err
+	}
+	c := &textFileCollector{
+		path:            *textFileDirectory,
+		recursive:       *textFileRecursive,
+		pathLabels:      pathLabels,
+		allowedPrefixes: allowedPrefixes,
+		timestamps:      *textFileTimestamps,
+		maxAge:          *textFileTimestampMaxAge,
+		maxFuture:       *textFileTimestampMaxFuture,
+		now:             time.Now,
+		logger:          logger,
+	}
+	if *textFileNamePolicy != "off" {
+		c.namePolicy = *textFileNamePolicy
+	}
+	return c, nil
 }
 
 func (c *textFileCollector) exportMTimes(mtimes map[string]time.Time, ch chan<- prometheus.Metric) {
@@ -186,8 +188,34 @@ func (c *textFileCollector) exportMTimes(mtimes map[string]time.Time, ch chan<-
 	}
 }
 
+// exportFileCounts exports a per-file count using desc, which must have a
+// single file label.
+func exportFileCounts(desc *prometheus.Desc, counts map[string]int, ch chan<- prometheus.Metric) {
+	// Sorting is needed for predictable output comparison in tests.
+	filepaths := make([]string, 0, len(counts))
+	for path := range counts {
+		filepaths = append(filepaths, path)
+	}
+	sort.Strings(filepaths)
+
+	for _, path := range filepaths {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(counts[path]), path)
+	}
+}
+
 // Update implements the Collector interface.
 func (c *textFileCollector) Update(ch chan<- prometheus.Metric) error {
+	return c.updateKnownNames(ch, nil)
+}
+
+// checksNames implements the knownNamesCollector interface.
+func (c *textFileCollector) checksNames() bool {
+	return c.namePolicy != ""
+}
+
+// updateKnownNames implements the knownNamesCollector interface. The name
+// policy rejects or renames families named like one in known.
+func (c *textFileCollector) updateKnownNames(ch chan<- prometheus.Metric, known map[string]bool) error {
 	// Iterate over files and accumulate their metrics, but also track any
 	// parsing errors so an error metric can be reported.
 	var errored bool
@@ -202,20 +230,41 @@ func (c *textFileCollector) Update(ch chan<- prometheus.Metric) error {
 	}
 
 	mtimes := make(map[string]time.Time)
+	rejected := make(map[string]int)
+	violations := make(map[string]int)
 	for _, path := range paths {
-		files, err := os.ReadDir(path)
+		files, err := c.listFiles(path)
 		if err != nil && path != "" {
 			errored = true
 			level.Error(c.logger).Log("msg", "failed to read textfile collector directory", "path", path, "err", err)
 		}
 
-		for _, f := range files {
-			metricsFilePath := filepath.Join(path, f.Name())
-			if !strings.HasSuffix(f.Name(), ".prom") {
+		for _, name := range files {
+			metricsFilePath := filepath.Join(path, name)
+			if textFileExpired(metricsFilePath) {
+				level.Debug(c.logger).Log("msg", "skipping expired textfile", "file", metricsFilePath)
 				continue
 			}
 
-			mtime, families, err := c.processFile(path, f.Name(), ch)
+			mtime, families, err := c.processFile(path, name, ch)
+
+			if c.timestamps && err == nil {
+				n := c.dropOutOfWindowSamples(families)
+				if n > 0 {
+					level.Warn(c.logger).Log("msg", "dropped textfile samples with timestamps outside the accepted window", "file", metricsFilePath, "samples", n)
+				}
+				rejected[metricsFilePath] = n
+			}
+
+			if labels := c.labelsFromPath(name); len(labels) > 0 {
+				addLabels(families, labels)
+			}
+
+			if c.namePolicy != "" && err == nil {
+				var n int
+				families, n = c.applyNamePolicy(path, metricsFilePath, families, known)
+				violations[metricsFilePath] = n
+			}
 
 			for _, mf := range families {
 				metricsNamesToFiles[*mf.Name] = append(metricsNamesToFiles[*mf.Name], metricsFilePath)
@@ -224,7 +273,7 @@ func (c *textFileCollector) Update(ch chan<- prometheus.Metric) error {
 
 			if err != nil {
 				errored = true
-				level.Error(c.logger).Log("msg", "failed to collect textfile data", "file", f.Name(), "err", err)
+				level.Error(c.logger).Log("msg", "failed to collect textfile data", "file", name, "err", err)
 				continue
 			}
 
@@ -244,6 +293,12 @@ func (c *textFileCollector) Update(ch chan<- prometheus.Metric) error {
 	}
 
 	c.exportMTimes(mtimes, ch)
+	if c.timestamps {
+		exportFileCounts(timestampRejectedDesc, rejected, ch)
+	}
+	if c.namePolicy != "" {
+		exportFileCounts(namePolicyViolationsDesc, violations, ch)
+	}
 
 	// Export if there were errors.
 	var errVal float64
@@ -263,6 +318,160 @@ func (c *textFileCollector) Update(ch chan<- prometheus.Metric) error {
 	return nil
 }
 
+// listFiles returns the names of the .prom files in dir, relative to dir. When
+// recursive collection is enabled subdirectories are descended into as well.
+func (c *textFileCollector) listFiles(dir string) ([]string, error) {
+	var names []string
+	if !c.recursive {
+		files, err := os.ReadDir(dir)
+		for _, f := range files {
+			if strings.HasSuffix(f.Name(), ".prom") {
+				names = append(names, f.Name())
+			}
+		}
+		return names, err
+	}
+
+	var walkErr error
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			// Keep collecting from the rest of the tree, but report the
+			// unreadable subdirectory.
+			walkErr = err
+			return nil
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".prom") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, rel)
+		return nil
+	})
+	if err != nil {
+		return names, err
+	}
+	return names, walkErr
+}
+
+// labelsFromPath returns the labels the path label template derives from the
+// path of a file relative to the textfile directory. Files not matching the
+// template get no additional labels.
+func (c *textFileCollector) labelsFromPath(rel string) map[string]string {
+	if len(c.pathLabels) == 0 {
+		return nil
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) != len(c.pathLabels) {
+		return nil
+	}
+	labels := make(map[string]string, len(parts))
+	for i, tmpl := range c.pathLabels {
+		part := parts[i]
+		if i == len(parts)-1 {
+			tmpl = strings.TrimSuffix(tmpl, ".prom")
+			part = strings.TrimSuffix(part, ".prom")
+		}
+		if strings.HasPrefix(tmpl, "<") && strings.HasSuffix(tmpl, ">") {
+			labels[tmpl[1:len(tmpl)-1]] = part
+		} else if tmpl != part {
+			return nil
+		}
+	}
+	return labels
+}
+
+// addLabels sets the given labels on every metric in families, replacing the
+// value of any label of the same name already present.
+func addLabels(families map[string]*dto.MetricFamily, labels map[string]string) {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, mf := range families {
+		for _, m := range mf.Metric {
+			for _, name := range names {
+				name, value := name, labels[name]
+				found := false
+				for _, lp := range m.Label {
+					if lp.GetName() == name {
+						lp.Value = &value
+						found = true
+						break
+					}
+				}
+				if !found {
+					m.Label = append(m.Label, &dto.LabelPair{Name: &name, Value: &value})
+				}
+			}
+		}
+	}
+}
+
+// applyNamePolicy rejects or renames the families of a file in dir whose names
+// lack the allowed prefix for dir or collide with the known metric families of
+// other collectors. It returns the remaining families and the number of
+// violations.
+func (c *textFileCollector) applyNamePolicy(dir, file string, families map[string]*dto.MetricFamily, known map[string]bool) (map[string]*dto.MetricFamily, int) {
+	prefix, ok := c.allowedPrefixes[filepath.Clean(dir)]
+	if !ok {
+		prefix = c.allowedPrefixes[""]
+	}
+	rewritePrefix := prefix
+	if rewritePrefix == "" {
+		rewritePrefix = "textfile_"
+	}
+
+	violation := func(name string) string {
+		if !strings.HasPrefix(name, prefix) {
+			return fmt.Sprintf("name lacks allowed prefix %q", prefix)
+		}
+		if known[name] {
+			return "name collides with a metric of another collector"
+		}
+		return ""
+	}
+
+	// Iterate in a stable order so that rewrites are deterministic.
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var violations int
+	result := make(map[string]*dto.MetricFamily, len(families))
+	for _, name := range names {
+		reason := violation(name)
+		if reason == "" {
+			result[name] = families[name]
+			continue
+		}
+		violations++
+
+		if c.namePolicy == "rewrite" {
+			newName := rewritePrefix + name
+			_, exists := families[newName]
+			if !exists && violation(newName) == "" {
+				level.Warn(c.logger).Log("msg", "renamed textfile metric violating the name policy", "file", file, "metric", name, "new_metric", newName, "reason", reason)
+				mf := families[name]
+				mf.Name = &newName
+				result[newName] = mf
+				continue
+			}
+		}
+		level.Warn(c.logger).Log("msg", "dropped textfile metric violating the name policy", "file", file, "metric", name, "reason", reason)
+	}
+	return result, violations
+}
+
 // processFile processes a single file, returning its modification time on success.
 func (c *textFileCollector) processFile(dir, name string, ch chan<- prometheus.Metric) (*time.Time, map[string]*dto.MetricFamily, error) {
 	path := filepath.Join(dir, name)
@@ -278,7 +487,7 @@ func (c *textFileCollector) processFile(dir, name string, ch chan<- prometheus.M
 		return nil, nil, fmt.Errorf("failed to parse textfile data from %q: %w", path, err)
 	}
 
-	if hasTimestamps(families) {
+	if !c.timestamps && hasTimestamps(families) {
 		return nil, nil, fmt.Errorf("textfile %q contains unsupported client-side timestamps, skipping entire file", path)
 	}
 
@@ -293,14 +502,26 @@ func (c *textFileCollector) processFile(dir, name string, ch chan<- prometheus.M
 	return &t, families, nil
 }
 
-// hasTimestamps returns true when metrics contain unsupported timestamps.
-func hasTimestamps(parsedFamilies map[string]*dto.MetricFamily) bool {
-	for _, mf := range parsedFamilies {
+// dropOutOfWindowSamples removes samples whose timestamp lies outside the
+// accepted window and returns how many were removed. Samples without a
+// timestamp are always kept.
+func (c *textFileCollector) dropOutOfWindowSamples(families map[string]*dto.MetricFamily) int {
+	now := c.now()
+	var dropped int
+	for _, mf := range families {
+		kept := mf.Metric[:0]
 		for _, m := range mf.Metric {
 			if m.TimestampMs != nil {
-				return true
+				ts := time.UnixMilli(m.GetTimestampMs())
+				if (c.maxAge > 0 && ts.Before(now.Add(-c.maxAge))) ||
+					(c.maxFuture > 0 && ts.After(now.Add(c.maxFuture))) {
+					dropped++
+					continue
+				}
 			}
+			kept = append(kept, m)
 		}
+		mf.Metric = kept
 	}
-	return false
+	return dropped
 }
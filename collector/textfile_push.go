@@ -0,0 +1,319 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !notextfile
+// +build !notextfile
+
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/expfmt"
+)
+
+// TextFilePushPath is the URL prefix the textfile push handler is served on.
+const TextFilePushPath = "/textfile/"
+
+var (
+	textFilePush        = kingpin.Flag("collector.textfile.push", "Accept PUT and DELETE requests on "+TextFilePushPath+"<name> to manage <name>.prom in the textfile directory.").Bool()
+	textFilePushMaxSize = kingpin.Flag("collector.textfile.push.max-size", "Maximum size of a pushed text file in bytes.").Default("4194304").Int64()
+
+	textFilePushNameRE = regexp.MustCompile(`^[a-zA-Z0-9_-][a-zA-Z0-9_.-]*$`)
+)
+
+// textFilePushHandler writes pushed metrics atomically into the textfile
+// directory, optionally removing them again after a TTL. The expiry time is
+// kept in a hidden file next to the text file, see textFileExpiryPath, so
+// that it survives restarts of the exporter.
+type textFilePushHandler struct {
+	dir        string
+	maxSize    int64
+	timestamps bool
+	logger     log.Logger
+
+	mtx    sync.Mutex
+	expiry map[string]*textFilePushExpiry
+}
+
+// textFilePushExpiry tracks the pending removal of a file pushed with a TTL.
+type textFilePushExpiry struct {
+	timer *time.Timer
+}
+
+// NewTextFilePushHandler returns the handler for the textfile push endpoint,
+// or nil if the endpoint or the textfile collector is not enabled.
+func NewTextFilePushHandler(logger log.Logger) (http.Handler, error) {
+	if !*textFilePush {
+		return nil, nil
+	}
+	if enabled, ok := collectorState["textfile"]; !ok || !*enabled {
+		level.Warn(logger).Log("msg", "Not serving textfile push endpoint, the textfile collector is disabled")
+		return nil, nil
+	}
+	dir := *textFileDirectory
+	if dir == "" {
+		return nil, errors.New("textfile push requires --collector.textfile.directory to be set")
+	}
+	if strings.ContainsAny(dir, "*?[") {
+		return nil, fmt.Errorf("textfile push requires a single textfile directory, got glob %q", dir)
+	}
+	h := &textFilePushHandler{
+		dir:        dir,
+		maxSize:    *textFilePushMaxSize,
+		timestamps: *textFileTimestamps,
+		logger:     logger,
+		expiry:     map[string]*textFilePushExpiry{},
+	}
+	h.restoreExpiry()
+	return h, nil
+}
+
+// restoreExpiry schedules the removal of the files pushed with a TTL before
+// the exporter was started. Files that expired in the meantime are removed
+// right away.
+func (h *textFilePushHandler) restoreExpiry() {
+	paths, err := filepath.Glob(filepath.Join(h.dir, ".*.prom"+textFileExpirySuffix))
+	if err != nil {
+		level.Error(h.logger).Log("msg", "failed to list textfile expiry files", "err", err)
+		return
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	for _, p := range paths {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(p), "."), ".prom"+textFileExpirySuffix)
+		if !textFilePushNameRE.MatchString(name) {
+			continue
+		}
+		t, err := readTextFileExpiry(h.path(name))
+		if err != nil {
+			level.Error(h.logger).Log("msg", "failed to read textfile expiry", "name", name, "err", err)
+			continue
+		}
+		h.schedule(name, time.Until(t))
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *textFilePushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, TextFilePushPath)
+	if !textFilePushNameRE.MatchString(name) {
+		http.Error(w, fmt.Sprintf("invalid textfile name %q", name), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		h.put(w, r, name)
+	case http.MethodDelete:
+		h.delete(w, name)
+	default:
+		w.Header().Set("Allow", "PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *textFilePushHandler) put(w http.ResponseWriter, r *http.Request, name string) {
+	var ttl time.Duration
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		var err error
+		ttl, err = time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			http.Error(w, fmt.Sprintf("invalid ttl %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxSize))
+	if err != nil {
+		code := http.StatusBadRequest
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, fmt.Sprintf("failed to read body: %s", err), code)
+		return
+	}
+
+	// Validate the body the same way the textfile collector will, so that a
+	// push is rejected instead of breaking the next scrape.
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse metrics: %s", err), http.StatusBadRequest)
+		return
+	}
+	if !h.timestamps && hasTimestamps(families) {
+		http.Error(w, "metrics contain unsupported client-side timestamps", http.StatusBadRequest)
+		return
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	// The expiry is updated first, so that a failure in between never
+	// removes the new file before its TTL.
+	path := h.path(name)
+	if ttl > 0 {
+		err = h.writeFile(textFileExpiryPath(path), []byte(time.Now().Add(ttl).Format(time.RFC3339Nano)+"\n"))
+	} else if err = os.Remove(textFileExpiryPath(path)); errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	if err == nil {
+		err = h.writeFile(path, body)
+	}
+	if err != nil {
+		level.Error(h.logger).Log("msg", "failed to write pushed textfile", "name", name, "err", err)
+		http.Error(w, "failed to write textfile", http.StatusInternalServerError)
+		return
+	}
+	level.Debug(h.logger).Log("msg", "wrote pushed textfile", "name", name, "ttl", ttl)
+
+	h.cancelExpiry(name)
+	if ttl > 0 {
+		h.schedule(name, ttl)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// schedule removes the file for name after d. It must be called with mtx
+// held.
+func (h *textFilePushHandler) schedule(name string, d time.Duration) {
+	e := &textFilePushExpiry{}
+	e.timer = time.AfterFunc(d, func() { h.expire(name, e) })
+	h.expiry[name] = e
+}
+
+// cancelExpiry stops the pending removal of the file for name. It must be
+// called with mtx held.
+func (h *textFilePushHandler) cancelExpiry(name string) {
+	if e, ok := h.expiry[name]; ok {
+		e.timer.Stop()
+		delete(h.expiry, name)
+	}
+}
+
+func (h *textFilePushHandler) delete(w http.ResponseWriter, name string) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	h.cancelExpiry(name)
+	err := h.removeFile(name)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, fmt.Sprintf("textfile %q not found", name), http.StatusNotFound)
+	case err != nil:
+		level.Error(h.logger).Log("msg", "failed to remove pushed textfile", "name", name, "err", err)
+		http.Error(w, "failed to remove textfile", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// expire removes the file for name once its TTL has passed, unless it was
+// pushed again in the meantime.
+func (h *textFilePushHandler) expire(name string, e *textFilePushExpiry) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if h.expiry[name] != e {
+		return
+	}
+	delete(h.expiry, name)
+	if err := h.removeFile(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		level.Error(h.logger).Log("msg", "failed to remove expired textfile", "name", name, "err", err)
+		return
+	}
+	level.Debug(h.logger).Log("msg", "removed expired textfile", "name", name)
+}
+
+func (h *textFilePushHandler) path(name string) string {
+	return filepath.Join(h.dir, name+".prom")
+}
+
+// removeFile removes the file for name and its expiry.
+func (h *textFilePushHandler) removeFile(name string) error {
+	path := h.path(name)
+	err := os.Remove(path)
+	if err := os.Remove(textFileExpiryPath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		level.Error(h.logger).Log("msg", "failed to remove textfile expiry", "name", name, "err", err)
+	}
+	return err
+}
+
+// writeFile atomically replaces the file at path with data. The temporary
+// file does not end in .prom, so the collector never reads it half-written.
+func (h *textFilePushHandler) writeFile(path string, data []byte) error {
+	f, err := os.CreateTemp(h.dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// textFileExpirySuffix ends the hidden file that holds the expiry time of a
+// text file pushed with a TTL.
+const textFileExpirySuffix = ".expiry"
+
+// textFileExpiryPath returns the path of the expiry of the text file at path.
+func textFileExpiryPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+textFileExpirySuffix)
+}
+
+func readTextFileExpiry(path string) (time.Time, error) {
+	b, err := os.ReadFile(textFileExpiryPath(path))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, strings.TrimSpace(string(b)))
+}
+
+// textFileExpired reports whether the text file at path was pushed with a
+// TTL that has passed. The textfile collector skips such files, which are
+// left behind if the exporter is stopped before removing them.
+func textFileExpired(path string) bool {
+	t, err := readTextFileExpiry(path)
+	return err == nil && !time.Now().Before(t)
+}
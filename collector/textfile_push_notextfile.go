@@ -0,0 +1,32 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build notextfile
+// +build notextfile
+
+package collector
+
+import (
+	"net/http"
+
+	"github.com/go-kit/log"
+)
+
+// TextFilePushPath is the URL prefix the textfile push handler is served on.
+const TextFilePushPath = "/textfile/"
+
+// NewTextFilePushHandler returns nil, the textfile push endpoint is built
+// with the textfile collector only.
+func NewTextFilePushHandler(_ log.Logger) (http.Handler, error) {
+	return nil, nil
+}
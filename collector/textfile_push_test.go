@@ -0,0 +1,179 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !notextfile
+// +build !notextfile
+
+package collector
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func TestTextFilePushHandler(t *testing.T) {
+	dir := t.TempDir()
+	h := &textFilePushHandler{
+		dir:     dir,
+		maxSize: 1024,
+		logger:  log.NewNopLogger(),
+		expiry:  map[string]*textFilePushExpiry{},
+	}
+
+	do := func(method, target, body string) int {
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rw.Code
+	}
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		code   int
+	}{
+		{http.MethodPut, "/textfile/job", "job_last_success 1\n", http.StatusNoContent},
+		{http.MethodPut, "/textfile/job", "job_last_success{ 1\n", http.StatusBadRequest},
+		{http.MethodPut, "/textfile/job", "job_last_success 1 1441205977284\n", http.StatusBadRequest},
+		{http.MethodPut, "/textfile/job", strings.Repeat("a", 2048), http.StatusRequestEntityTooLarge},
+		{http.MethodPut, "/textfile/job?ttl=never", "job_last_success 1\n", http.StatusBadRequest},
+		{http.MethodPut, "/textfile/../job", "job_last_success 1\n", http.StatusBadRequest},
+		{http.MethodPut, "/textfile/.hidden", "job_last_success 1\n", http.StatusBadRequest},
+		{http.MethodPut, "/textfile/sub/job", "job_last_success 1\n", http.StatusBadRequest},
+		{http.MethodGet, "/textfile/job", "", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/textfile/missing", "", http.StatusNotFound},
+	}
+	for i, test := range tests {
+		if got := do(test.method, test.target, test.body); got != test.code {
+			t.Errorf("%d. %s %s: want status %d, got %d", i, test.method, test.target, test.code, got)
+		}
+	}
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodPut, "/textfile/job", iotest.ErrReader(errors.New("connection reset"))))
+	if rw.Code != http.StatusBadRequest {
+		t.Errorf("failed body read: want status %d, got %d", http.StatusBadRequest, rw.Code)
+	}
+
+	// Rejected pushes must leave the accepted file untouched.
+	path := filepath.Join(dir, "job.prom")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "job_last_success 1\n" {
+		t.Errorf("unexpected file content %q", data)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only job.prom in textfile directory, got %d entries", len(entries))
+	}
+
+	if got := do(http.MethodDelete, "/textfile/job", ""); got != http.StatusNoContent {
+		t.Fatalf("delete: want status %d, got %d", http.StatusNoContent, got)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", path, err)
+	}
+
+	if got := do(http.MethodPut, "/textfile/job?ttl=10ms", "job_last_success 1\n"); got != http.StatusNoContent {
+		t.Fatalf("put with ttl: want status %d, got %d", http.StatusNoContent, got)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s to expire", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTextFilePushExpiryRestart(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, expiry time.Time) string {
+		path := filepath.Join(dir, name+".prom")
+		if err := os.WriteFile(path, []byte("job_last_success 1\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(textFileExpiryPath(path), []byte(expiry.Format(time.RFC3339Nano)+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	// Pushed with TTLs by an earlier run of the exporter.
+	expired := write("expired", time.Now().Add(-time.Minute))
+	pending := write("pending", time.Now().Add(time.Hour))
+
+	if !textFileExpired(expired) || textFileExpired(pending) {
+		t.Errorf("want only %s expired", expired)
+	}
+
+	h := &textFilePushHandler{
+		dir:    dir,
+		logger: log.NewNopLogger(),
+		expiry: map[string]*textFilePushExpiry{},
+	}
+	h.restoreExpiry()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := os.Stat(expired)
+		_, sidecarErr := os.Stat(textFileExpiryPath(expired))
+		if os.IsNotExist(err) && os.IsNotExist(sidecarErr) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s and its expiry to be removed", expired)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if _, ok := h.expiry["pending"]; !ok {
+		t.Error("expected the removal of pending.prom to be scheduled")
+	}
+	if _, err := os.Stat(pending); err != nil {
+		t.Errorf("expected %s to be kept, got %v", pending, err)
+	}
+	h.cancelExpiry("pending")
+}
+
+func TestTextFilePushHandlerCollectorDisabled(t *testing.T) {
+	defer func(push, enabled bool, dir string) {
+		*textFilePush, *collectorState["textfile"], *textFileDirectory = push, enabled, dir
+	}(*textFilePush, *collectorState["textfile"], *textFileDirectory)
+	*textFilePush, *collectorState["textfile"], *textFileDirectory = true, false, t.TempDir()
+
+	h, err := NewTextFilePushHandler(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h != nil {
+		t.Error("expected no handler while the textfile collector is disabled")
+	}
+}
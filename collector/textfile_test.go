@@ -21,7 +21,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/go-kit/log"
@@ -51,8 +53,13 @@ func (a collectorAdapter) Collect(ch chan<- prometheus.Metric) {
 
 func TestTextfileCollector(t *testing.T) {
 	tests := []struct {
-		path string
-		out  string
+		path       string
+		out        string
+		timestamps bool
+		recursive  bool
+		pathLabels string
+		namePolicy string
+		prefixes   map[string]string
 	}{
 		{
 			path: "fixtures/textfile/no_metric_files",
@@ -70,6 +77,48 @@ func TestTextfileCollector(t *testing.T) {
 			path: "fixtures/textfile/client_side_timestamp",
 			out:  "fixtures/textfile/client_side_timestamp.out",
 		},
+		{
+			path:       "fixtures/textfile/client_side_timestamp",
+			out:        "fixtures/textfile/client_side_timestamp_enabled.out",
+			timestamps: true,
+		},
+		{
+			path:       "fixtures/textfile/client_side_timestamp_window",
+			out:        "fixtures/textfile/client_side_timestamp_window.out",
+			timestamps: true,
+		},
+		{
+			path: "fixtures/textfile/recursive",
+			out:  "fixtures/textfile/recursive_disabled.out",
+		},
+		{
+			path:      "fixtures/textfile/recursive",
+			out:       "fixtures/textfile/recursive.out",
+			recursive: true,
+		},
+		{
+			path:       "fixtures/textfile/recursive",
+			out:        "fixtures/textfile/recursive_path_labels.out",
+			recursive:  true,
+			pathLabels: "<team>/<job>.prom",
+		},
+		{
+			path:       "fixtures/textfile/name_policy",
+			out:        "fixtures/textfile/name_policy_reject.out",
+			namePolicy: "reject",
+			prefixes:   map[string]string{"fixtures/textfile/name_policy": "team_"},
+		},
+		{
+			path:       "fixtures/textfile/name_policy",
+			out:        "fixtures/textfile/name_policy_rewrite.out",
+			namePolicy: "rewrite",
+			prefixes:   map[string]string{"": "team_"},
+		},
+		{
+			path:       "fixtures/textfile/name_policy",
+			out:        "fixtures/textfile/name_policy_collision.out",
+			namePolicy: "rewrite",
+		},
 		{
 			path: "fixtures/textfile/different_metric_types",
 			out:  "fixtures/textfile/different_metric_types.out",
@@ -116,12 +165,27 @@ func TestTextfileCollector(t *testing.T) {
 		},
 	}
 
+	// Names of the metrics of other collectors.
+	known := map[string]bool{"node_cpu_seconds_total": true}
+
 	for i, test := range tests {
 		mtime := 1.0
+		pathLabels, err := parsePathLabelsTemplate(test.pathLabels)
+		if err != nil {
+			t.Fatalf("%d. invalid path label template %q: %s", i, test.pathLabels, err)
+		}
 		c := &textFileCollector{
-			path:   test.path,
-			mtime:  &mtime,
-			logger: log.NewNopLogger(),
+			path:            test.path,
+			recursive:       test.recursive,
+			pathLabels:      pathLabels,
+			namePolicy:      test.namePolicy,
+			allowedPrefixes: test.prefixes,
+			timestamps:      test.timestamps,
+			maxAge:          time.Hour,
+			maxFuture:       5 * time.Minute,
+			mtime:           &mtime,
+			now:             func() time.Time { return time.Unix(1441205977, 0) },
+			logger:          log.NewNopLogger(),
 		}
 
 		// Suppress a log message about `nonexistent_path` not existing, this is
@@ -133,7 +197,7 @@ func TestTextfileCollector(t *testing.T) {
 		}
 
 		registry := prometheus.NewRegistry()
-		registry.MustRegister(collectorAdapter{c})
+		registry.MustRegister(collectorAdapter{knownNamesUpdater{c: c, known: known}})
 
 		rw := httptest.NewRecorder()
 		promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError}).ServeHTTP(rw, &http.Request{})
@@ -149,3 +213,54 @@ func TestTextfileCollector(t *testing.T) {
 		}
 	}
 }
+
+type cpuSecondsCollector struct{}
+
+func (cpuSecondsCollector) Update(ch chan<- prometheus.Metric) error {
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("node_cpu_seconds_total", "Seconds the CPUs spent in each mode.", []string{"cpu", "mode"}, nil),
+		prometheus.CounterValue, 1, "0", "idle")
+	return nil
+}
+
+func TestTextfileNamePolicyGatherer(t *testing.T) {
+	mtime := 1.0
+	nc := &NodeCollector{
+		Collectors: map[string]Collector{
+			"cpu": cpuSecondsCollector{},
+			"textfile": &textFileCollector{
+				path:       "fixtures/textfile/name_policy",
+				namePolicy: "reject",
+				mtime:      &mtime,
+				logger:     log.NewNopLogger(),
+			},
+		},
+		logger: log.NewNopLogger(),
+	}
+	g, err := NewNodeGatherer(nc, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The collision is detected in the first scrape.
+	mfs, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		switch mf.GetName() {
+		case "node_cpu_seconds_total":
+			got[mf.GetName()] = float64(len(mf.Metric))
+		case "node_textfile_name_policy_violations":
+			got[mf.GetName()] = mf.Metric[0].GetGauge().GetValue()
+		}
+	}
+	want := map[string]float64{
+		"node_cpu_seconds_total":               1,
+		"node_textfile_name_policy_violations": 1,
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
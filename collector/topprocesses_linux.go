@@ -0,0 +1,175 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !notopprocesses
+// +build !notopprocesses
+
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+// topProcessesUserHZ is the unit of the CPU times in /proc/<pid>/stat, which
+// is fixed at 100 on Linux.
+const topProcessesUserHZ = 100
+
+var topProcessesCount = kingpin.Flag("collector.topprocesses.count", "Number of processes to report for each resource.").Default("5").Int()
+
+// topProcessKey identifies a process across PID reuse.
+type topProcessKey struct {
+	pid       int
+	startTime uint64
+}
+
+// topProcessSample holds the cumulative counters of a process at a scrape.
+type topProcessSample struct {
+	cpuTicks uint
+	io       float64
+	hasIO    bool
+}
+
+// topProcessEntry is a process ranked by value.
+type topProcessEntry struct {
+	pid   int
+	comm  string
+	value float64
+}
+
+type topProcessesCollector struct {
+	fs     procfs.FS
+	count  int
+	cpu    typedDesc
+	memory typedDesc
+	io     typedDesc
+	logger log.Logger
+	now    func() time.Time
+
+	mtx      sync.Mutex
+	prev     map[topProcessKey]topProcessSample
+	prevTime time.Time
+}
+
+func init() {
+	registerCollector("topprocesses", defaultDisabled, NewTopProcessesCollector)
+}
+
+// NewTopProcessesCollector returns a new Collector exposing the processes
+// using the most CPU, memory and I/O.
+func NewTopProcessesCollector(logger log.Logger) (Collector, error) {
+	const subsystem = "top_process"
+
+	if *topProcessesCount <= 0 {
+		return nil, fmt.Errorf("invalid top processes count %d", *topProcessesCount)
+	}
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open procfs: %w", err)
+	}
+
+	topDesc := func(name, help string) typedDesc {
+		return typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, name),
+			help, []string{"rank", "pid", "comm"}, nil,
+		), prometheus.GaugeValue}
+	}
+	return &topProcessesCollector{
+		fs:     fs,
+		count:  *topProcessesCount,
+		cpu:    topDesc("cpu_usage_ratio", "CPU seconds per second used since the previous scrape by the processes using the most CPU."),
+		memory: topDesc("resident_memory_bytes", "Resident memory of the processes using the most memory."),
+		io:     topDesc("io_bytes_per_second", "Bytes per second read from and written to storage since the previous scrape by the processes doing the most I/O."),
+		logger: logger,
+		now:    time.Now,
+	}, nil
+}
+
+// Update implements the Collector interface. Rates are only known from the
+// second scrape on, and only for processes that existed in the previous one.
+func (c *topProcessesCollector) Update(ch chan<- prometheus.Metric) error {
+	procs, err := c.fs.AllProcs()
+	if err != nil {
+		return fmt.Errorf("unable to list all processes: %w", err)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := c.now()
+	interval := now.Sub(c.prevTime).Seconds()
+	samples := make(map[topProcessKey]topProcessSample, len(procs))
+	var cpu, memory, io []topProcessEntry
+	for _, p := range procs {
+		stat, err := p.Stat()
+		if err != nil {
+			// The process exited, or is a zombie without readable stat.
+			level.Debug(c.logger).Log("msg", "failed to read process stat", "pid", p.PID, "err", err)
+			continue
+		}
+		key := topProcessKey{pid: p.PID, startTime: stat.Starttime}
+		sample := topProcessSample{cpuTicks: stat.UTime + stat.STime}
+		// I/O accounting of processes of other users requires
+		// CAP_SYS_PTRACE.
+		if pio, err := p.IO(); err == nil {
+			sample.io = float64(pio.ReadBytes + pio.WriteBytes)
+			sample.hasIO = true
+		}
+		samples[key] = sample
+
+		memory = append(memory, topProcessEntry{p.PID, stat.Comm, float64(stat.ResidentMemory())})
+		prev, ok := c.prev[key]
+		if !ok || interval <= 0 {
+			continue
+		}
+		if sample.cpuTicks >= prev.cpuTicks {
+			cpu = append(cpu, topProcessEntry{p.PID, stat.Comm, float64(sample.cpuTicks-prev.cpuTicks) / topProcessesUserHZ / interval})
+		}
+		if sample.hasIO && prev.hasIO {
+			io = append(io, topProcessEntry{p.PID, stat.Comm, (sample.io - prev.io) / interval})
+		}
+	}
+	c.prev = samples
+	c.prevTime = now
+
+	c.exportTop(ch, c.cpu, cpu)
+	c.exportTop(ch, c.memory, memory)
+	c.exportTop(ch, c.io, io)
+	return nil
+}
+
+// exportTop exposes the entries with the highest non-zero values, ranked
+// from 1.
+func (c *topProcessesCollector) exportTop(ch chan<- prometheus.Metric, desc typedDesc, entries []topProcessEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].value != entries[j].value {
+			return entries[i].value > entries[j].value
+		}
+		return entries[i].pid < entries[j].pid
+	})
+	for i, e := range entries {
+		if i >= c.count || e.value <= 0 {
+			break
+		}
+		ch <- desc.mustNewConstMetric(e.value, strconv.Itoa(i+1), strconv.Itoa(e.pid), e.comm)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !notopprocesses
+// +build !notopprocesses
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type testTopProcessesCollector struct {
+	tc Collector
+}
+
+func (c testTopProcessesCollector) Collect(ch chan<- prometheus.Metric) {
+	c.tc.Update(ch)
+}
+
+func (c testTopProcessesCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func writeTopProcess(t *testing.T, dir string, pid int, comm string, ticks, rssPages, ioBytes uint64) {
+	pidDir := filepath.Join(dir, strconv.Itoa(pid))
+	if err := os.MkdirAll(pidDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	stat := fmt.Sprintf("%d (%s) S 1 %d %d 0 -1 4194560 0 0 0 0 %d 0 0 0 20 0 1 0 %d 109604864 %d 18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0 0 0 0 0 0 0 0 0\n",
+		pid, comm, pid, pid, ticks, pid, rssPages)
+	io := fmt.Sprintf("rchar: 0\nwchar: 0\nsyscr: 0\nsyscw: 0\nread_bytes: %d\nwrite_bytes: 0\ncancelled_write_bytes: 0\n", ioBytes)
+	for file, data := range map[string]string{"stat": stat, "io": io} {
+		if err := os.WriteFile(filepath.Join(pidDir, file), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTopProcesses(t *testing.T) {
+	dir := t.TempDir()
+	writeTopProcess(t, dir, 100, "idle", 10, 100, 0)
+	writeTopProcess(t, dir, 200, "busy", 500, 10, 4096)
+	writeTopProcess(t, dir, 300, "fat", 20, 1000, 1024)
+
+	oldProcPath, oldCount := *procPath, *topProcessesCount
+	defer func() { *procPath, *topProcessesCount = oldProcPath, oldCount }()
+	*procPath = dir
+	*topProcessesCount = 2
+
+	c, err := NewTopProcessesCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1000, 0)
+	c.(*topProcessesCollector).now = func() time.Time { return now }
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&testTopProcessesCollector{tc: c})
+	if _, err := reg.Gather(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Over 10 seconds busy uses 5 CPU seconds and fat reads 10 kB/s.
+	now = now.Add(10 * time.Second)
+	writeTopProcess(t, dir, 100, "idle", 10, 100, 0)
+	writeTopProcess(t, dir, 200, "busy", 1000, 10, 4096)
+	writeTopProcess(t, dir, 300, "fat", 30, 1000, 103424)
+	// A new process has no rate yet.
+	writeTopProcess(t, dir, 400, "new", 100000, 1, 1<<30)
+
+	pageSize := os.Getpagesize()
+	expected := fmt.Sprintf(`# HELP node_top_process_cpu_usage_ratio CPU seconds per second used since the previous scrape by the processes using the most CPU.
+# TYPE node_top_process_cpu_usage_ratio gauge
+node_top_process_cpu_usage_ratio{comm="busy",pid="200",rank="1"} 0.5
+node_top_process_cpu_usage_ratio{comm="fat",pid="300",rank="2"} 0.01
+# HELP node_top_process_io_bytes_per_second Bytes per second read from and written to storage since the previous scrape by the processes doing the most I/O.
+# TYPE node_top_process_io_bytes_per_second gauge
+node_top_process_io_bytes_per_second{comm="fat",pid="300",rank="1"} 10240
+# HELP node_top_process_resident_memory_bytes Resident memory of the processes using the most memory.
+# TYPE node_top_process_resident_memory_bytes gauge
+node_top_process_resident_memory_bytes{comm="fat",pid="300",rank="1"} %d
+node_top_process_resident_memory_bytes{comm="idle",pid="100",rank="2"} %d
+`, 1000*pageSize, 100*pageSize)
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
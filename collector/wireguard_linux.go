@@ -0,0 +1,319 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nowireguard
+// +build !nowireguard
+
+package collector
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/josharian/native"
+	"github.com/jsimonetti/rtnetlink"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// Generic netlink family of include/uapi/linux/wireguard.h.
+	wgGenlName           = "wireguard"
+	wgCmdGetDevice       = 0
+	wgDeviceAIfname      = 2
+	wgDeviceAListenPort  = 6
+	wgDeviceAPeers       = 8
+	wgPeerAPublicKey     = 1
+	wgPeerALastHandshake = 6
+	wgPeerARxBytes       = 7
+	wgPeerATxBytes       = 8
+	wgPeerAAllowedIPs    = 9
+	sizeOfKernelTimespec = 16
+
+	wgLinkKind = "wireguard"
+)
+
+var (
+	wireguardDeviceInclude = kingpin.Flag("collector.wireguard.device-include", "Regexp of WireGuard devices to include (mutually exclusive to device-exclude).").String()
+	wireguardDeviceExclude = kingpin.Flag("collector.wireguard.device-exclude", "Regexp of WireGuard devices to exclude (mutually exclusive to device-include).").String()
+	wireguardPeerNames     = kingpin.Flag("collector.wireguard.peer-names-file", "File mapping peer public keys to names, one \"<public key> <name>\" per line, added as name label.").String()
+)
+
+type wireguardCollector struct {
+	deviceFilter  deviceFilter
+	peerNamesFile string
+
+	listenPort    typedDesc
+	peers         typedDesc
+	lastHandshake typedDesc
+	receiveBytes  typedDesc
+	transmitBytes typedDesc
+	allowedIPs    typedDesc
+
+	logger log.Logger
+}
+
+func init() {
+	registerCollector("wireguard", defaultDisabled, NewWireGuardCollector)
+}
+
+// NewWireGuardCollector returns a new Collector exposing WireGuard device and
+// peer statistics.
+func NewWireGuardCollector(logger log.Logger) (Collector, error) {
+	peerLabels := []string{"device", "public_key"}
+	if *wireguardPeerNames != "" {
+		peerLabels = append(peerLabels, "name")
+	}
+	desc := func(name, help string, valueType prometheus.ValueType, labels []string) typedDesc {
+		return typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "wireguard", name),
+			help, labels, nil,
+		), valueType}
+	}
+	deviceLabels := []string{"device"}
+	return &wireguardCollector{
+		deviceFilter:  newDeviceFilter(*wireguardDeviceExclude, *wireguardDeviceInclude),
+		peerNamesFile: *wireguardPeerNames,
+
+		listenPort:    desc("device_listen_port", "UDP port the WireGuard device listens on.", prometheus.GaugeValue, deviceLabels),
+		peers:         desc("device_peers", "Number of peers of the WireGuard device.", prometheus.GaugeValue, deviceLabels),
+		lastHandshake: desc("peer_last_handshake_timestamp_seconds", "Time of the last handshake with the peer, 0 if there was none.", prometheus.GaugeValue, peerLabels),
+		receiveBytes:  desc("peer_receive_bytes_total", "Bytes received from the peer.", prometheus.CounterValue, peerLabels),
+		transmitBytes: desc("peer_transmit_bytes_total", "Bytes sent to the peer.", prometheus.CounterValue, peerLabels),
+		allowedIPs:    desc("peer_allowed_ips", "Number of allowed IP networks of the peer.", prometheus.GaugeValue, peerLabels),
+
+		logger: logger,
+	}, nil
+}
+
+// wireguardDevice is the state of a WireGuard device.
+type wireguardDevice struct {
+	name       string
+	listenPort uint16
+	peers      []*wireguardPeer
+}
+
+type wireguardPeer struct {
+	publicKey string // base64 encoded, as shown by wg
+	// Time of the last handshake, in seconds and nanoseconds since the epoch.
+	lastHandshakeSec  int64
+	lastHandshakeNsec int64
+	receiveBytes      uint64
+	transmitBytes     uint64
+	allowedIPs        int
+}
+
+func (c *wireguardCollector) Update(ch chan<- prometheus.Metric) error {
+	names, err := wireguardDeviceNames()
+	if err != nil {
+		return fmt.Errorf("couldn't list WireGuard devices: %w", err)
+	}
+
+	conn, err := genetlink.Dial(nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	family, err := conn.GetFamily(wgGenlName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "WireGuard generic netlink family not found, module probably not loaded")
+			return ErrNoData
+		}
+		return fmt.Errorf("couldn't get WireGuard generic netlink family: %w", err)
+	}
+
+	var peerNames map[string]string
+	if c.peerNamesFile != "" {
+		f, err := os.Open(c.peerNamesFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if peerNames, err = parseWireGuardPeerNames(f); err != nil {
+			return fmt.Errorf("couldn't parse %s: %w", c.peerNamesFile, err)
+		}
+	}
+
+	for _, name := range names {
+		if c.deviceFilter.ignored(name) {
+			continue
+		}
+		device, err := getWireGuardDevice(conn, family, name)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// The device is gone.
+				continue
+			}
+			return fmt.Errorf("couldn't get WireGuard device %s: %w", name, err)
+		}
+
+		ch <- c.listenPort.mustNewConstMetric(float64(device.listenPort), device.name)
+		ch <- c.peers.mustNewConstMetric(float64(len(device.peers)), device.name)
+		for _, peer := range device.peers {
+			labels := []string{device.name, peer.publicKey}
+			if peerNames != nil {
+				labels = append(labels, peerNames[peer.publicKey])
+			}
+			lastHandshake := float64(peer.lastHandshakeSec) + float64(peer.lastHandshakeNsec)/1e9
+			ch <- c.lastHandshake.mustNewConstMetric(lastHandshake, labels...)
+			ch <- c.receiveBytes.mustNewConstMetric(float64(peer.receiveBytes), labels...)
+			ch <- c.transmitBytes.mustNewConstMetric(float64(peer.transmitBytes), labels...)
+			ch <- c.allowedIPs.mustNewConstMetric(float64(peer.allowedIPs), labels...)
+		}
+	}
+
+	return nil
+}
+
+// wireguardDeviceNames returns the names of the WireGuard links, which the
+// wireguard family can't list.
+func wireguardDeviceNames() ([]string, error) {
+	conn, err := rtnetlink.Dial(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	links, err := conn.Link.List()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, link := range links {
+		if link.Attributes != nil && link.Attributes.Info != nil && link.Attributes.Info.Kind == wgLinkKind {
+			names = append(names, link.Attributes.Name)
+		}
+	}
+	return names, nil
+}
+
+func getWireGuardDevice(conn *genetlink.Conn, family genetlink.Family, name string) (*wireguardDevice, error) {
+	ae := netlink.NewAttributeEncoder()
+	ae.String(wgDeviceAIfname, name)
+	data, err := ae.Encode()
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := conn.Execute(genetlink.Message{
+		Header: genetlink.Header{
+			Command: wgCmdGetDevice,
+			Version: family.Version,
+		},
+		Data: data,
+	}, family.ID, netlink.Request|netlink.Dump)
+	if err != nil {
+		return nil, err
+	}
+	return parseWireGuardDevice(msgs)
+}
+
+// parseWireGuardDevice parses the messages of a device dump. Devices with many
+// peers are split over several messages, each repeating the device
+// attributes, and a peer with many allowed IPs continues in the next message.
+func parseWireGuardDevice(msgs []genetlink.Message) (*wireguardDevice, error) {
+	var device wireguardDevice
+
+	for _, m := range msgs {
+		ad, err := netlink.NewAttributeDecoder(m.Data)
+		if err != nil {
+			return nil, err
+		}
+		for ad.Next() {
+			switch ad.Type() {
+			case wgDeviceAIfname:
+				device.name = ad.String()
+			case wgDeviceAListenPort:
+				device.listenPort = ad.Uint16()
+			case wgDeviceAPeers:
+				ad.Nested(func(nad *netlink.AttributeDecoder) error {
+					for nad.Next() {
+						peer := &wireguardPeer{}
+						nad.Nested(func(pad *netlink.AttributeDecoder) error {
+							return parseWireGuardPeer(pad, peer)
+						})
+						if n := len(device.peers); n > 0 && device.peers[n-1].publicKey == peer.publicKey {
+							device.peers[n-1].allowedIPs += peer.allowedIPs
+							continue
+						}
+						device.peers = append(device.peers, peer)
+					}
+					return nad.Err()
+				})
+			}
+		}
+		if err := ad.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &device, nil
+}
+
+func parseWireGuardPeer(ad *netlink.AttributeDecoder, peer *wireguardPeer) error {
+	for ad.Next() {
+		switch ad.Type() {
+		case wgPeerAPublicKey:
+			peer.publicKey = base64.StdEncoding.EncodeToString(ad.Bytes())
+		case wgPeerALastHandshake:
+			// struct __kernel_timespec
+			b := ad.Bytes()
+			if len(b) < sizeOfKernelTimespec {
+				return fmt.Errorf("short last handshake time of %d bytes", len(b))
+			}
+			peer.lastHandshakeSec = int64(native.Endian.Uint64(b))
+			peer.lastHandshakeNsec = int64(native.Endian.Uint64(b[8:]))
+		case wgPeerARxBytes:
+			peer.receiveBytes = ad.Uint64()
+		case wgPeerATxBytes:
+			peer.transmitBytes = ad.Uint64()
+		case wgPeerAAllowedIPs:
+			ad.Nested(func(nad *netlink.AttributeDecoder) error {
+				for nad.Next() {
+					peer.allowedIPs++
+				}
+				return nad.Err()
+			})
+		}
+	}
+	return ad.Err()
+}
+
+// parseWireGuardPeerNames parses lines of a public key and a name, separated
+// by white space. Names may contain spaces. Empty lines and lines starting with # are ignored.
+func parseWireGuardPeerNames(r io.Reader) (map[string]string, error) {
+	names := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key := strings.Fields(line)[0]
+		name := strings.TrimSpace(line[len(key):])
+		if name == "" {
+			return nil, fmt.Errorf("missing name for public key %q", key)
+		}
+		names[key] = name
+	}
+	return names, scanner.Err()
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nowireguard
+// +build !nowireguard
+
+package collector
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/josharian/native"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+)
+
+type testWireGuardPeer struct {
+	key        byte
+	handshake  [2]int64
+	rx, tx     uint64
+	allowedIPs int
+}
+
+// encodeWireGuardDevice encodes a message of a WG_CMD_GET_DEVICE dump.
+func encodeWireGuardDevice(t *testing.T, peers ...testWireGuardPeer) genetlink.Message {
+	ae := netlink.NewAttributeEncoder()
+	ae.String(wgDeviceAIfname, "wg0")
+	ae.Uint16(wgDeviceAListenPort, 51820)
+	ae.Nested(wgDeviceAPeers, func(nae *netlink.AttributeEncoder) error {
+		for i, p := range peers {
+			nae.Nested(uint16(i), func(pae *netlink.AttributeEncoder) error {
+				pae.Bytes(wgPeerAPublicKey, bytes.Repeat([]byte{p.key}, 32))
+				ts := make([]byte, sizeOfKernelTimespec)
+				native.Endian.PutUint64(ts, uint64(p.handshake[0]))
+				native.Endian.PutUint64(ts[8:], uint64(p.handshake[1]))
+				pae.Bytes(wgPeerALastHandshake, ts)
+				pae.Uint64(wgPeerARxBytes, p.rx)
+				pae.Uint64(wgPeerATxBytes, p.tx)
+				pae.Nested(wgPeerAAllowedIPs, func(iae *netlink.AttributeEncoder) error {
+					for j := 0; j < p.allowedIPs; j++ {
+						iae.Nested(uint16(j), func(*netlink.AttributeEncoder) error { return nil })
+					}
+					return nil
+				})
+				return nil
+			})
+		}
+		return nil
+	})
+	data, err := ae.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return genetlink.Message{Data: data}
+}
+
+func TestParseWireGuardDevice(t *testing.T) {
+	msgs := []genetlink.Message{
+		encodeWireGuardDevice(t,
+			testWireGuardPeer{key: 1, handshake: [2]int64{1700000000, 500000000}, rx: 100, tx: 200, allowedIPs: 2},
+			testWireGuardPeer{key: 2, allowedIPs: 1},
+		),
+		// The allowed IPs of the second peer continue in the next message.
+		encodeWireGuardDevice(t,
+			testWireGuardPeer{key: 2, allowedIPs: 3},
+			testWireGuardPeer{key: 3, rx: 1, tx: 2},
+		),
+	}
+
+	device, err := parseWireGuardDevice(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.name != "wg0" || device.listenPort != 51820 {
+		t.Errorf("unexpected device %+v", device)
+	}
+	want := []*wireguardPeer{
+		{publicKey: "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=", lastHandshakeSec: 1700000000, lastHandshakeNsec: 500000000, receiveBytes: 100, transmitBytes: 200, allowedIPs: 2},
+		{publicKey: "AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI=", allowedIPs: 4},
+		{publicKey: "AwMDAwMDAwMDAwMDAwMDAwMDAwMDAwMDAwMDAwMDAwM=", receiveBytes: 1, transmitBytes: 2},
+	}
+	if !reflect.DeepEqual(want, device.peers) {
+		for i, p := range device.peers {
+			t.Errorf("peer %d: %+v", i, p)
+		}
+	}
+}
+
+func TestParseWireGuardPeerNames(t *testing.T) {
+	names, err := parseWireGuardPeerNames(strings.NewReader(`
+# Site links
+AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE= berlin
+AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI=	new york
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=": "berlin",
+		"AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI=": "new york",
+	}
+	if !reflect.DeepEqual(want, names) {
+		t.Errorf("want %v, got %v", want, names)
+	}
+
+	if _, err := parseWireGuardPeerNames(strings.NewReader("AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=\n")); err == nil {
+		t.Error("want error for a key without name")
+	}
+}
@@ -9,6 +9,7 @@ enabled_collectors=$(cat << COLLECTORS
   btrfs
   buddyinfo
   cgroups
+  cgroupstats
   conntrack
   cpu
   cpufreq
@@ -32,6 +33,7 @@ enabled_collectors=$(cat << COLLECTORS
   meminfo_numa
   mountstats
   netdev
+  netfilter
   netstat
   nfs
   nfsd
@@ -39,6 +41,7 @@ enabled_collectors=$(cat << COLLECTORS
   processes
   qdisc
   rapl
+  restartrequired
   schedstat
   slabinfo
   sockstat
@@ -132,6 +135,11 @@ fi
   --collector.textfile.directory="collector/fixtures/textfile/two_metric_files/" \
   --collector.wifi.fixtures="collector/fixtures/wifi" \
   --collector.qdisc.fixtures="collector/fixtures/qdisc/" \
+  --collector.conntrack.per-cpu \
+  --collector.conntrack.entries-breakdown \
+  --collector.conntrack.fixtures="collector/fixtures/conntrack/" \
+  --collector.netfilter.fixtures="collector/fixtures/netfilter/" \
+  --collector.netfilter.chain-exclude="forward" \
   --collector.qdisc.device-include="(wlan0|eth0)" \
   --collector.arp.device-exclude="nope" \
   --no-collector.arp.netlink \
@@ -139,6 +147,7 @@ fi
   --collector.netclass.ignored-devices="(dmz|int)" \
   --collector.netclass.ignore-invalid-speed \
   --collector.netdev.device-include="lo" \
+  --collector.cgroupstats.pressure \
   --collector.bcache.priorityStats \
   "${cpu_info_collector}" \
   --collector.cpu.info.bugs-include="${cpu_info_bugs}" \
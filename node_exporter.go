@@ -120,14 +120,15 @@ func (h *handler) innerHandler(filters ...string) (http.Handler, error) {
 
 	r := prometheus.NewRegistry()
 	r.MustRegister(version.NewCollector("node_exporter"))
-	if err := r.Register(nc); err != nil {
+	g, err := collector.NewNodeGatherer(nc, r)
+	if err != nil {
 		return nil, fmt.Errorf("couldn't register node collector: %s", err)
 	}
 
 	var handler http.Handler
 	if h.includeExporterMetrics {
 		handler = promhttp.HandlerFor(
-			prometheus.Gatherers{h.exporterMetricsRegistry, r},
+			prometheus.Gatherers{h.exporterMetricsRegistry, g},
 			promhttp.HandlerOpts{
 				ErrorLog:            stdlog.New(log.NewStdlibAdapter(level.Error(h.logger)), "", 0),
 				ErrorHandling:       promhttp.ContinueOnError,
@@ -142,7 +143,7 @@ func (h *handler) innerHandler(filters ...string) (http.Handler, error) {
 		)
 	} else {
 		handler = promhttp.HandlerFor(
-			r,
+			g,
 			promhttp.HandlerOpts{
 				ErrorLog:            stdlog.New(log.NewStdlibAdapter(level.Error(h.logger)), "", 0),
 				ErrorHandling:       promhttp.ContinueOnError,
@@ -198,6 +199,14 @@ func main() {
 	level.Debug(logger).Log("msg", "Go MAXPROCS", "procs", runtime.GOMAXPROCS(0))
 
 	http.Handle(*metricsPath, newHandler(!*disableExporterMetrics, *maxRequests, logger))
+	pushHandler, err := collector.NewTextFilePushHandler(logger)
+	if err != nil {
+		level.Error(logger).Log("err", err)
+		os.Exit(1)
+	}
+	if pushHandler != nil {
+		http.Handle(collector.TextFilePushPath, pushHandler)
+	}
 	if *metricsPath != "/" {
 		landingConfig := web.LandingConfig{
 			Name:        "Node Exporter",